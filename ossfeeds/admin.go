@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler of the admin endpoints: metrics for Prometheus, liveness and
+// readiness. The poller is ready while every feed polled successfully
+// within the stall limit, so that a stalled feed fails the probe
+func newAdminHandler(m *pollerMetrics, stallAfter time.Duration) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		stalled := m.stalledFeeds(stallAfter, time.Now())
+		if len(stalled) == 0 {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+
+		lines := make([]string, 0, len(stalled))
+		for _, ecosystem := range sortedKeys(stalled) {
+			lines = append(lines, fmt.Sprintf("%s: no successful poll for %s",
+				ecosystem, stalled[ecosystem].Round(time.Second)))
+		}
+
+		http.Error(w, strings.Join(lines, "\n"), http.StatusServiceUnavailable)
+	})
+
+	return mux
+}
+
+// Serve the admin endpoints in the background
+func startAdminServer(addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		fmt.Printf("Serving admin endpoints on %s\n", addr)
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Printf("Error serving admin endpoints: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, server *httptest.Server, path string) (int, string) {
+	res, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := newPollerMetrics()
+	m.registerFeed(npmEcosystem)
+	m.registerFeed(pypiEcosystem)
+
+	m.observePoll(npmEcosystem, 2*time.Second, 3, false)
+	m.observePoll(npmEcosystem, 200*time.Millisecond, 0, true)
+	m.lossyFeedEvents.WithLabelValues(npmEcosystem).Inc()
+	m.submissions.WithLabelValues(npmEcosystem).Add(3)
+	m.submissionFailures.WithLabelValues("Unavailable").Inc()
+	m.verdicts.WithLabelValues(verdictMalicious).Inc()
+	m.gauge("ossfeeds_submission_queue_depth", "Packages waiting for submission.", func() float64 { return 7 })
+
+	server := httptest.NewServer(newAdminHandler(m, time.Hour))
+	defer server.Close()
+
+	status, body := get(t, server, "/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	expected := []string{
+		"# TYPE ossfeeds_packages_seen_total counter",
+		`ossfeeds_packages_seen_total{ecosystem="npm"} 3`,
+		`ossfeeds_poll_errors_total{ecosystem="npm"} 1`,
+		`ossfeeds_lossy_feed_events_total{ecosystem="npm"} 1`,
+		`ossfeeds_submissions_total{ecosystem="npm"} 3`,
+		`ossfeeds_submission_failures_total{code="Unavailable"} 1`,
+		`ossfeeds_verdicts_total{verdict="malicious"} 1`,
+		"# TYPE ossfeeds_poll_duration_seconds histogram",
+		`ossfeeds_poll_duration_seconds_bucket{ecosystem="npm",le="0.1"} 0`,
+		`ossfeeds_poll_duration_seconds_bucket{ecosystem="npm",le="0.5"} 1`,
+		`ossfeeds_poll_duration_seconds_bucket{ecosystem="npm",le="2.5"} 2`,
+		`ossfeeds_poll_duration_seconds_bucket{ecosystem="npm",le="+Inf"} 2`,
+		`ossfeeds_poll_duration_seconds_sum{ecosystem="npm"} 2.2`,
+		`ossfeeds_poll_duration_seconds_count{ecosystem="npm"} 2`,
+		`ossfeeds_last_successful_poll_timestamp_seconds{ecosystem="pypi"} 0`,
+		"ossfeeds_submission_queue_depth 7",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in metrics:\n%s", line, body)
+		}
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	m := newPollerMetrics()
+	m.registerFeed(npmEcosystem)
+	m.registerFeed(pypiEcosystem)
+
+	server := httptest.NewServer(newAdminHandler(m, time.Hour))
+	defer server.Close()
+
+	if status, _ := get(t, server, "/healthz"); status != http.StatusOK {
+		t.Errorf("healthz: unexpected status %d", status)
+	}
+
+	// Feeds have an hour from the start of the process to poll
+	if status, body := get(t, server, "/readyz"); status != http.StatusOK {
+		t.Errorf("readyz: unexpected status %d: %s", status, body)
+	}
+
+	m.started = time.Now().Add(-2 * time.Hour)
+	m.observePoll(npmEcosystem, time.Second, 1, false)
+
+	status, body := get(t, server, "/readyz")
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("readyz: expected the stalled feed to fail the probe, got %d", status)
+	}
+
+	if !strings.Contains(body, "pypi: no successful poll for 2h0m0s") || strings.Contains(body, "npm") {
+		t.Errorf("readyz: expected only pypi stalled, got %q", body)
+	}
+}
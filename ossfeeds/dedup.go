@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+// Key of a package version submitted for analysis
+func packageKey(ecosystem string, pkg *feeds.Package) string {
+	return ecosystem + "/" + pkg.Name + "@" + pkg.Version
+}
+
+// Package versions already submitted for analysis. Feeds are lossy and
+// overlap between polls, the same version is submitted once. The most
+// recently seen versions are kept in a bounded LRU, backed by a file the
+// keys are appended to so that they survive restarts. The file is
+// compacted to the keys of the LRU once it grows past twice its size
+type seenSet struct {
+	m      sync.Mutex
+	recent *lru.Cache[string, struct{}]
+
+	path  string
+	file  *os.File
+	lines int
+}
+
+// Open the seen set, loading the most recent keys of the file. An empty
+// path keeps the set in memory only
+func openSeenSet(path string, size int) (*seenSet, error) {
+	recent, err := lru.New[string, struct{}](size)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &seenSet{recent: recent, path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("error reading seen packages: %w", err)
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("error compacting seen packages: %w", err)
+	}
+
+	return s, nil
+}
+
+// Load the keys of the file, oldest first so that the LRU keeps the most
+// recent ones
+func (s *seenSet) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			s.recent.Add(key, struct{}{})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Rewrite the file with the keys of the LRU and reopen it for appending
+func (s *seenSet) compact() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+
+		s.file = nil
+	}
+
+	keys := s.recent.Keys()
+
+	var data strings.Builder
+	for _, key := range keys {
+		data.WriteString(key)
+		data.WriteByte('\n')
+	}
+
+	if err := writeFileAtomic(s.path, []byte(data.String())); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.lines = len(keys)
+
+	return nil
+}
+
+// Check whether a package version was seen, counting as a use of the key
+func (s *seenSet) seen(key string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	_, ok := s.recent.Get(key)
+	return ok
+}
+
+// Record a package version as seen
+func (s *seenSet) add(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.recent.Contains(key) {
+		return nil
+	}
+
+	s.recent.Add(key, struct{}{})
+	if s.file == nil {
+		return nil
+	}
+
+	if _, err := s.file.WriteString(key + "\n"); err != nil {
+		return fmt.Errorf("error recording seen package: %w", err)
+	}
+
+	s.lines++
+	if s.lines > 2*s.recent.Len() {
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("error compacting seen packages: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *seenSet) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
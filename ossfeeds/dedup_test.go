@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLines(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Fields(string(data))
+}
+
+func TestSeenSetRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.txt")
+
+	seen, err := openSeenSet(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"npm/a@1", "npm/b@1", "npm/c@1", "npm/b@1", "npm/d@1"} {
+		if err := seen.add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := seen.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys already seen are not appended again
+	if actual := strings.Join(readLines(t, path), ","); actual != "npm/a@1,npm/b@1,npm/c@1,npm/d@1" {
+		t.Errorf("unexpected seen file: %s", actual)
+	}
+
+	// The file is loaded oldest first, the LRU keeps the most recent keys
+	// and the file is compacted to them
+	seen, err = openSeenSet(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer seen.Close()
+
+	for key, expected := range map[string]bool{"npm/a@1": false, "npm/b@1": true, "npm/c@1": true, "npm/d@1": true} {
+		if actual := seen.seen(key); actual != expected {
+			t.Errorf("seen(%s): expected %v, got %v", key, expected, actual)
+		}
+	}
+
+	if actual := strings.Join(readLines(t, path), ","); actual != "npm/b@1,npm/c@1,npm/d@1" {
+		t.Errorf("expected the seen file compacted on open, got %s", actual)
+	}
+}
+
+func TestSeenSetCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.txt")
+
+	seen, err := openSeenSet(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"npm/a@1", "npm/b@1", "npm/c@1", "npm/d@1", "npm/e@1", "npm/f@1"}
+	for i, key := range keys {
+		if err := seen.add(key); err != nil {
+			t.Fatal(err)
+		}
+
+		// The file never grows past twice the size of the LRU
+		if lines := readLines(t, path); len(lines) > 4 {
+			t.Errorf("after %d keys: expected at most 4 lines, got %v", i+1, lines)
+		}
+	}
+
+	// The fifth key compacted the file, appends continue after it
+	if actual := strings.Join(readLines(t, path), ","); actual != "npm/d@1,npm/e@1,npm/f@1" {
+		t.Errorf("unexpected seen file: %s", actual)
+	}
+
+	if err := seen.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err = openSeenSet(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer seen.Close()
+
+	if !seen.seen("npm/e@1") || !seen.seen("npm/f@1") || seen.seen("npm/d@1") {
+		t.Errorf("expected the two most recent keys after a restart")
+	}
+}
+
+func TestSeenSetMemory(t *testing.T) {
+	seen, err := openSeenSet("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seen.add("npm/a@1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !seen.seen("npm/a@1") || seen.seen("npm/b@1") {
+		t.Errorf("unexpected keys of an in memory set")
+	}
+}
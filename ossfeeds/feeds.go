@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	packagev1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/messages/package/v1"
+	"github.com/ossf/package-feeds/pkg/events"
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/feeds/crates"
+	"github.com/ossf/package-feeds/pkg/feeds/goproxy"
+	"github.com/ossf/package-feeds/pkg/feeds/maven"
+	"github.com/ossf/package-feeds/pkg/feeds/npm"
+	"github.com/ossf/package-feeds/pkg/feeds/nuget"
+	"github.com/ossf/package-feeds/pkg/feeds/packagist"
+	"github.com/ossf/package-feeds/pkg/feeds/pypi"
+	"github.com/ossf/package-feeds/pkg/feeds/rubygems"
+)
+
+const (
+	npmEcosystem       = "npm"
+	rubygemsEcosystem  = "rubygems"
+	pypiEcosystem      = "pypi"
+	cratesEcosystem    = "crates"
+	goEcosystem        = "go"
+	nugetEcosystem     = "nuget"
+	mavenEcosystem     = "maven"
+	packagistEcosystem = "packagist"
+
+	// Enables the feeds of all supported ecosystems
+	allEcosystems = "all"
+)
+
+// Ecosystems with a feed, in the order they are started
+var supportedEcosystems = []string{
+	npmEcosystem,
+	pypiEcosystem,
+	rubygemsEcosystem,
+	cratesEcosystem,
+	goEcosystem,
+	nugetEcosystem,
+	mavenEcosystem,
+	packagistEcosystem,
+}
+
+// Ecosystems of the malware analysis service
+var specEcosystems = map[string]packagev1.Ecosystem{
+	npmEcosystem:       packagev1.Ecosystem_ECOSYSTEM_NPM,
+	rubygemsEcosystem:  packagev1.Ecosystem_ECOSYSTEM_RUBYGEMS,
+	pypiEcosystem:      packagev1.Ecosystem_ECOSYSTEM_PYPI,
+	cratesEcosystem:    packagev1.Ecosystem_ECOSYSTEM_CARGO,
+	goEcosystem:        packagev1.Ecosystem_ECOSYSTEM_GO,
+	nugetEcosystem:     packagev1.Ecosystem_ECOSYSTEM_NUGET,
+	mavenEcosystem:     packagev1.Ecosystem_ECOSYSTEM_MAVEN,
+	packagistEcosystem: packagev1.Ecosystem_ECOSYSTEM_PACKAGIST,
+}
+
+type eventHandler struct {
+	ecosystem string
+	metrics   *pollerMetrics
+}
+
+func (n *eventHandler) AddEvent(e events.Event) error {
+	fmt.Printf("Event: Ecosystem: %s Type: %s Message: %s\n",
+		n.ecosystem, e.GetType(), e.GetMessage())
+
+	if e.GetType() == events.LossyFeedEventType {
+		n.metrics.lossyFeedEvents.WithLabelValues(n.ecosystem).Inc()
+	}
+
+	return nil
+}
+
+type feedListener interface {
+	Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
+}
+
+// Handler of the events raised by a feed, such as a lossy poll
+func newFeedEventHandler(ecosystem string, m *pollerMetrics) *events.Handler {
+	return events.NewHandler(&eventHandler{ecosystem: ecosystem, metrics: m},
+		events.Filter{
+			EnabledEventTypes: []string{events.LossyFeedEventType, events.FeedsComponentType},
+		})
+}
+
+func buildFeedListener(name string, m *pollerMetrics) (feedListener, error) {
+	var feedListener feedListener
+	var err error
+
+	switch name {
+	case npmEcosystem:
+		feedListener, err = npm.New(feeds.FeedOptions{}, newFeedEventHandler(name, m))
+	case rubygemsEcosystem:
+		feedListener, err = rubygems.New(feeds.FeedOptions{}, newFeedEventHandler(name, m))
+	case pypiEcosystem:
+		feedListener, err = pypi.New(feeds.FeedOptions{}, newFeedEventHandler(name, m))
+	case cratesEcosystem:
+		feedListener, err = crates.New(feeds.FeedOptions{}, newFeedEventHandler(name, m))
+	case goEcosystem:
+		feedListener, err = goproxy.New(feeds.FeedOptions{})
+	case nugetEcosystem:
+		feedListener, err = nuget.New(feeds.FeedOptions{})
+	case mavenEcosystem:
+		feedListener, err = maven.New(feeds.FeedOptions{})
+	case packagistEcosystem:
+		feedListener, err = packagist.New(feeds.FeedOptions{})
+	default:
+		err = fmt.Errorf("unsupported feed: %s", name)
+	}
+
+	return feedListener, err
+}
+
+// Parse a comma separated list of ecosystems, "all" enables every
+// supported ecosystem. Duplicates are dropped
+func parseEcosystems(value string) ([]string, error) {
+	ecosystems := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		names := []string{name}
+		if name == allEcosystems {
+			names = supportedEcosystems
+		} else if _, ok := specEcosystems[name]; !ok {
+			return nil, fmt.Errorf("unsupported ecosystem: %s", name)
+		}
+
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				ecosystems = append(ecosystems, name)
+			}
+		}
+	}
+
+	if len(ecosystems) == 0 {
+		return nil, fmt.Errorf("no ecosystem to poll")
+	}
+
+	return ecosystems, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEcosystems(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected string
+		err      bool
+	}{
+		{"single", "npm", "npm", false},
+		{"commas and spaces", " npm , pypi,crates ", "npm,pypi,crates", false},
+		{"case", "NPM,PyPI", "npm,pypi", false},
+		{"duplicates", "npm,pypi,npm", "npm,pypi", false},
+		{"empty items", "npm,,pypi,", "npm,pypi", false},
+		{"all", "all", strings.Join(supportedEcosystems, ","), false},
+		{"all after an ecosystem", "maven,all", "maven,npm,pypi,rubygems,crates,go,nuget,packagist", false},
+		{"unknown ecosystem", "npm,cpan", "", true},
+		{"empty", "", "", true},
+		{"only separators", " , ,", "", true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ecosystems, err := parseEcosystems(test.value)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ecosystems)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := strings.Join(ecosystems, ","); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBuildFeedListener(t *testing.T) {
+	for _, ecosystem := range supportedEcosystems {
+		t.Run(ecosystem, func(t *testing.T) {
+			feedListener, err := buildFeedListener(ecosystem, newPollerMetrics())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if feedListener == nil {
+				t.Errorf("expected a feed")
+			}
+		})
+	}
+
+	if _, err := buildFeedListener("cpan", newPollerMetrics()); err == nil {
+		t.Errorf("expected an error for an unsupported feed")
+	}
+}
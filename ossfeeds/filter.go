@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+// Rules of the packages of an ecosystem submitted for analysis. A package
+// is dropped when it matches a deny rule. When allow rules are given, a
+// package is kept only when it matches one of them or is similar to a
+// name of the similar list
+type filterRules struct {
+	// Name globs, as matched by path.Match
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+
+	// Name regular expressions
+	AllowPatterns []string `json:"allow_patterns,omitempty"`
+	DenyPatterns  []string `json:"deny_patterns,omitempty"`
+
+	// Scopes of names, such as @types for npm or a Maven group id
+	AllowScopes []string `json:"allow_scopes,omitempty"`
+	DenyScopes  []string `json:"deny_scopes,omitempty"`
+
+	// Names, such as our dependencies, packages are kept when their name is
+	// within the edit distance of one of them. The listed names are kept
+	// too, their new versions are worth analyzing as much as their squats
+	SimilarTo   []string `json:"similar_to,omitempty"`
+	MaxDistance int      `json:"max_distance,omitempty"`
+
+	allowPatterns []*regexp.Regexp
+	denyPatterns  []*regexp.Regexp
+}
+
+// Edit distance of similar names unless configured
+const defaultMaxDistance = 2
+
+// Rules by ecosystem, the rules of "*" apply to all ecosystems. A package
+// must pass both the rules of all ecosystems and the ones of its own
+type filterConfig map[string]*filterRules
+
+// Load the filter configuration, a JSON file of rules by ecosystem
+func loadFilterConfig(file string) (filterConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading filter config: %w", err)
+	}
+
+	var config filterConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error decoding filter config %s: %w", file, err)
+	}
+
+	for ecosystem, rules := range config {
+		if _, ok := specEcosystems[ecosystem]; !ok && (ecosystem != "*") {
+			return nil, fmt.Errorf("filter config: unsupported ecosystem: %s", ecosystem)
+		}
+
+		if rules == nil {
+			return nil, fmt.Errorf("filter config of %s: no rules", ecosystem)
+		}
+
+		if err := rules.compile(); err != nil {
+			return nil, fmt.Errorf("filter config of %s: %w", ecosystem, err)
+		}
+	}
+
+	return config, nil
+}
+
+// Check the globs and compile the regular expressions of the rules
+func (r *filterRules) compile() error {
+	for _, glob := range append(append([]string{}, r.Allow...), r.Deny...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+
+			compiled = append(compiled, re)
+		}
+
+		return compiled, nil
+	}
+
+	var err error
+	if r.allowPatterns, err = compile(r.AllowPatterns); err != nil {
+		return err
+	}
+
+	if r.denyPatterns, err = compile(r.DenyPatterns); err != nil {
+		return err
+	}
+
+	if r.MaxDistance <= 0 {
+		r.MaxDistance = defaultMaxDistance
+	}
+
+	return nil
+}
+
+// Check whether a package of an ecosystem passes the rules
+func (c filterConfig) keep(ecosystem string, pkg *feeds.Package) bool {
+	for _, key := range []string{"*", ecosystem} {
+		if rules, ok := c[key]; ok && !rules.keep(ecosystem, pkg.Name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *filterRules) keep(ecosystem, name string) bool {
+	scope := packageScope(ecosystem, name)
+
+	if matchGlobs(r.Deny, name) || matchPatterns(r.denyPatterns, name) ||
+		((scope != "") && matchScopes(r.DenyScopes, scope)) {
+		return false
+	}
+
+	if (len(r.Allow) == 0) && (len(r.allowPatterns) == 0) && (len(r.AllowScopes) == 0) && (len(r.SimilarTo) == 0) {
+		return true
+	}
+
+	return matchGlobs(r.Allow, name) || matchPatterns(r.allowPatterns, name) ||
+		((scope != "") && matchScopes(r.AllowScopes, scope)) || r.similar(name)
+}
+
+// Check whether a name is within the edit distance of a name of the
+// similar list, ignoring case
+func (r *filterRules) similar(name string) bool {
+	name = strings.ToLower(name)
+	for _, other := range r.SimilarTo {
+		if editDistance(name, strings.ToLower(other)) <= r.MaxDistance {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchGlobs(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPatterns(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchScopes(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if strings.EqualFold(s, scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scope of a package name: the @scope of npm, the vendor of Packagist,
+// the group id of Maven and the host of Go modules. Empty when the name
+// has none
+func packageScope(ecosystem, name string) string {
+	switch ecosystem {
+	case npmEcosystem:
+		if scope, _, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+			return scope
+		}
+	case packagistEcosystem, goEcosystem:
+		if scope, _, ok := strings.Cut(name, "/"); ok {
+			return scope
+		}
+	case mavenEcosystem:
+		if scope, _, ok := strings.Cut(name, ":"); ok {
+			return scope
+		}
+	}
+
+	return ""
+}
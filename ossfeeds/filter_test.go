@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+func TestFilterConfig(t *testing.T) {
+	config, err := loadFilterConfig(filepath.Join("testdata", "filter.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ecosystem string
+		name      string
+		expected  bool
+	}{
+		// Similar to the list, exact names included
+		{npmEcosystem, "express", true},
+		{npmEcosystem, "expresss", true},
+		{npmEcosystem, "1odash", true},
+		{npmEcosystem, "left-pad", false},
+		// Scopes
+		{npmEcosystem, "@safedep/vet", true},
+		{npmEcosystem, "@types/react", false},
+		// Deny rules of all ecosystems win over allow rules
+		{npmEcosystem, "express-test", false},
+		// Globs and patterns
+		{pypiEcosystem, "django-rest", true},
+		{pypiEcosystem, "django-testing", false},
+		{pypiEcosystem, "request", true},
+		{pypiEcosystem, "requestsx", false},
+		{mavenEcosystem, "org.apache.logging.log4j:log4j-core", true},
+		{mavenEcosystem, "org.example:log4j-core", false},
+		// Ecosystems without rules keep everything but denied names
+		{cratesEcosystem, "serde", true},
+		{cratesEcosystem, "test_serde", false},
+	}
+
+	for _, test := range cases {
+		pkg := &feeds.Package{Name: test.name, Version: "1.0.0"}
+		if actual := config.keep(test.ecosystem, pkg); actual != test.expected {
+			t.Errorf("keep(%s, %s) = %v, expected %v", test.ecosystem, test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestFilterConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown ecosystem": `{"cpan": {"allow": ["*"]}}`,
+		"invalid glob":      `{"npm": {"deny": ["[a"]}}`,
+		"invalid pattern":   `{"*": {"deny_patterns": ["(a"]}}`,
+		"null rules":        `{"npm": null}`,
+	}
+
+	for name, config := range cases {
+		file := filepath.Join(t.TempDir(), "filter.json")
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadFilterConfig(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNoFilterConfig(t *testing.T) {
+	var config filterConfig
+	if !config.keep(npmEcosystem, &feeds.Package{Name: "left-pad"}) {
+		t.Errorf("expected packages kept without config")
+	}
+}
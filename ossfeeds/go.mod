@@ -5,18 +5,26 @@ go 1.23.2
 require (
 	buf.build/gen/go/safedep/api/grpc/go v1.5.1-20241205081347-29d2e8505797.1
 	buf.build/gen/go/safedep/api/protocolbuffers/go v1.35.2-20241205081347-29d2e8505797.1
+	github.com/hashicorp/golang-lru/v2 v2.0.7
 	github.com/ossf/package-feeds v0.0.0-20240903033607-939890176fa6
+	github.com/prometheus/client_golang v1.20.5
 	github.com/safedep/dry v0.0.0-20241205053748-945ecaca69ba
 	google.golang.org/grpc v1.68.0
 )
 
 require (
 	buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go v1.35.2-20241127180247-a33202765966.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/grpc-ecosystem/go-grpc-middleware v1.4.0 // indirect
-	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/kolo/xmlrpc v0.0.0-20220921171641-a4b6fa1dd06b // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.57.0 // indirect
 	go.opentelemetry.io/otel v1.32.0 // indirect
@@ -6,80 +6,180 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"buf.build/gen/go/safedep/api/grpc/go/safedep/services/malysis/v1/malysisv1grpc"
 	malysisv1pb "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/messages/malysis/v1"
 	packagev1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/messages/package/v1"
 	malysisv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/malysis/v1"
-	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
-	"github.com/ossf/package-feeds/pkg/feeds/npm"
-	"github.com/ossf/package-feeds/pkg/feeds/pypi"
-	"github.com/ossf/package-feeds/pkg/feeds/rubygems"
 	drygrpc "github.com/safedep/dry/adapters/grpc"
 	"google.golang.org/grpc"
 )
 
-const (
-	npmEcosystem      = "npm"
-	rubygemsEcosystem = "rubygems"
-	pypiEcosystem     = "pypi"
-)
+var (
+	inputEcosystem string
+	pollInterval   time.Duration
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	rateLimitPause time.Duration
+	stateFile      string
+	backfillFrom   string
+	seenFile       string
+	seenSize       int
+	reportInterval time.Duration
+	reportTimeout  time.Duration
+	reportDeadline time.Duration
+	resultsFile    string
+	webhookURL     string
+	slackURL       string
+	kafkaRESTURL   string
+	kafkaTopic     string
+	workers        int
+	queueSize      int
+	submitTimeout  time.Duration
+	submitRetries  int
+	statsInterval  time.Duration
+	filterFile     string
 
-type eventHandler struct{}
+	typosquatCorpus    string
+	typosquatThreshold float64
+	typosquatOnly      bool
 
-func (n *eventHandler) AddEvent(e events.Event) error {
-	fmt.Printf("Event: Type: %s Message: %s\n",
-		e.GetType(), e.GetMessage())
+	adminAddr  string
+	stallAfter time.Duration
+)
 
-	return nil
+func init() {
+	flag.StringVar(&inputEcosystem, "ecosystem", npmEcosystem,
+		fmt.Sprintf("Comma separated ecosystems to poll, %q for all of %s", allEcosystems,
+			strings.Join(supportedEcosystems, ", ")))
+	flag.DurationVar(&pollInterval, "poll-interval", time.Minute, "Time between polls of a feed")
+	flag.DurationVar(&backoffInitial, "backoff-initial", 5*time.Second, "Delay before retrying a failed poll")
+	flag.DurationVar(&backoffMax, "backoff-max", 15*time.Minute, "Maximum delay between retries of a failing feed")
+	flag.DurationVar(&rateLimitPause, "rate-limit-pause", time.Minute,
+		"Pause of the polls of a feed rate limited by its registry")
+	flag.StringVar(&stateFile, "state-file", "ossfeeds-state.json",
+		"File checkpointing the cutoff of each feed, empty to start an hour back on every run")
+	flag.StringVar(&backfillFrom, "backfill-from", "",
+		"Poll the feeds from this RFC 3339 timestamp instead of their checkpoint")
+	flag.StringVar(&seenFile, "seen-file", "ossfeeds-seen.txt",
+		"File recording the package versions submitted, empty to remember them until exit only")
+	flag.IntVar(&seenSize, "seen-size", 100000, "Package versions remembered to skip repeated submissions")
+	flag.DurationVar(&reportInterval, "report-interval", 30*time.Second, "Time between polls of pending analysis reports")
+	flag.DurationVar(&reportTimeout, "report-timeout", time.Hour,
+		"Time after which an analysis without report is recorded as unknown, 0 to wait forever")
+	flag.DurationVar(&reportDeadline, "report-call-timeout", 30*time.Second, "Deadline of a call fetching a report")
+	flag.StringVar(&resultsFile, "results-file", "", "Append verdicts as JSON lines to this file, - for stdout")
+	flag.StringVar(&webhookURL, "webhook-url", "",
+		"Post verdicts to this webhook, signed with OSSFEEDS_WEBHOOK_SECRET when set")
+	flag.StringVar(&slackURL, "slack-webhook-url", "", "Post malicious and suspicious verdicts to this Slack webhook")
+	flag.StringVar(&kafkaRESTURL, "kafka-rest-url", "", "Publish verdicts through this Kafka REST proxy")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "package-verdicts", "Kafka topic of the verdicts")
+	flag.IntVar(&workers, "workers", 4, "Concurrent submissions for analysis")
+	flag.IntVar(&queueSize, "queue-size", 1000, "Packages waiting for submission before feeds block")
+	flag.DurationVar(&submitTimeout, "submit-timeout", 30*time.Second, "Deadline of a submission call")
+	flag.IntVar(&submitRetries, "submit-retries", 5, "Retries of a submission failing with a transient error")
+	flag.DurationVar(&statsInterval, "stats-interval", time.Minute, "Time between prints of the submission queue stats")
+	flag.StringVar(&filterFile, "filter-config", "", "JSON file of the rules of the packages submitted, empty for all")
+	flag.StringVar(&typosquatCorpus, "typosquat-corpus", "",
+		"JSON file of popular package names by ecosystem, replacing the built in ones")
+	flag.Float64Var(&typosquatThreshold, "typosquat-threshold", 0.7,
+		"Typosquat score from which packages are submitted first")
+	flag.BoolVar(&typosquatOnly, "typosquat-only", false, "Submit only packages scoring above the typosquat threshold")
+	flag.StringVar(&adminAddr, "admin-addr", ":9090", "Address of the metrics and health endpoints, empty to disable")
+	flag.DurationVar(&stallAfter, "stall-after", 30*time.Minute,
+		"Time without a successful poll after which a feed fails the readiness probe")
 }
 
-type feedListener interface {
-	Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
-}
+// Sinks of the verdicts enabled by flags
+func buildResultSinks() (multiSink, error) {
+	sinks := multiSink{}
 
-func buildFeedListener(name string) (feedListener, error) {
-	var feedListener feedListener
-	var err error
-
-	switch name {
-	case npmEcosystem:
-		feedListener, err = npm.New(feeds.FeedOptions{}, events.NewHandler(&eventHandler{},
-			events.Filter{
-				EnabledEventTypes: []string{events.LossyFeedEventType, events.FeedsComponentType},
-			}))
-	case rubygemsEcosystem:
-		feedListener, err = rubygems.New(feeds.FeedOptions{}, events.NewHandler(&eventHandler{},
-			events.Filter{
-				EnabledEventTypes: []string{events.LossyFeedEventType, events.FeedsComponentType},
-			}))
-	case pypiEcosystem:
-		feedListener, err = pypi.New(feeds.FeedOptions{}, events.NewHandler(&eventHandler{},
-			events.Filter{
-				EnabledEventTypes: []string{events.LossyFeedEventType, events.FeedsComponentType},
-			}))
-	default:
-		err = fmt.Errorf("unsupported feed: %s", name)
-	}
-
-	return feedListener, err
-}
+	if resultsFile != "" {
+		sink, err := newJSONLSink(resultsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, sink)
+	}
 
-var inputEcosystem string
+	if webhookURL != "" {
+		sinks = append(sinks, newWebhookSink(webhookURL, os.Getenv("OSSFEEDS_WEBHOOK_SECRET")))
+	}
 
-func init() {
-	flag.StringVar(&inputEcosystem, "ecosystem", npmEcosystem, "Ecosystem to poll")
-	flag.Parse()
+	if slackURL != "" {
+		sinks = append(sinks, newSlackSink(slackURL))
+	}
+
+	if kafkaRESTURL != "" {
+		sinks = append(sinks, newPublisherSink(newKafkaRESTPublisher(kafkaRESTURL), kafkaTopic))
+	}
+
+	return sinks, nil
 }
 
 func main() {
-	feedListener, err := buildFeedListener(inputEcosystem)
+	flag.Parse()
+
+	ecosystems, err := parseEcosystems(inputEcosystem)
+	if err != nil {
+		panic(err)
+	}
+
+	var backfillCutoff time.Time
+	if backfillFrom != "" {
+		backfillCutoff, err = time.Parse(time.RFC3339, backfillFrom)
+		if err != nil {
+			panic(fmt.Errorf("invalid backfill timestamp: %w", err))
+		}
+	}
+
+	var filter filterConfig
+	if filterFile != "" {
+		filter, err = loadFilterConfig(filterFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	typosquats, err := newTyposquatScorer(typosquatCorpus)
 	if err != nil {
 		panic(err)
 	}
 
+	state, err := openStateStore(stateFile)
+	if err != nil {
+		panic(err)
+	}
+
+	seen, err := openSeenSet(seenFile, seenSize)
+	if err != nil {
+		panic(err)
+	}
+
+	defer seen.Close()
+
+	sinks, err := buildResultSinks()
+	if err != nil {
+		panic(err)
+	}
+
+	defer sinks.Close()
+
+	metrics := newPollerMetrics()
+
+	feedListeners := make(map[string]feedListener)
+	for _, ecosystem := range ecosystems {
+		feedListeners[ecosystem], err = buildFeedListener(ecosystem, metrics)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	tok := os.Getenv("SAFEDEP_API_KEY")
 	tenantId := os.Getenv("SAFEDEP_TENANT_ID")
 
@@ -96,38 +196,234 @@ func main() {
 		panic(err)
 	}
 
+	// Feeds share the connection to the malware analysis service
 	service := malysisv1grpc.NewMalwareAnalysisServiceClient(cc)
 
-	cutoff := time.Now().Add(-time.Hour * 1)
+	p := &poller{
+		state:      state,
+		seen:       seen,
+		filter:     filter,
+		typosquats: typosquats,
+		metrics:    metrics,
+		// A verdict is delivered again to every sink until all of them
+		// accept it, sinks may see it more than once
+		reports: newReportTracker(service, state, reportInterval, reportTimeout, reportDeadline, func(result analysisResult) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := sinks.Write(ctx, result); err != nil {
+				return fmt.Errorf("error delivering verdict: %w", err)
+			}
+
+			printResult(result)
+			metrics.verdicts.WithLabelValues(result.Verdict).Inc()
+			return nil
+		}),
+	}
+
+	go p.reports.run()
+
+	p.submissions = newSubmissionPool(queueSize, typosquatThreshold, submitTimeout, submitRetries,
+		backoff{initial: time.Second, max: 30 * time.Second},
+		func(ctx context.Context, s submission) (string, error) {
+			return submitForAnalysis(ctx, service, s.ecosystem, s.pkg)
+		},
+		p.submitted, p.rejected, metrics)
+
+	p.submissions.start(workers)
+	go p.submissions.reportStats(statsInterval)
+
+	metrics.gauge("ossfeeds_submission_queue_depth", "Packages waiting for submission.",
+		func() float64 { return float64(p.submissions.depth()) })
+	metrics.gauge("ossfeeds_submissions_in_flight", "Submissions being sent.",
+		func() float64 { return float64(p.submissions.stats.inFlight.Load()) })
+	metrics.gauge("ossfeeds_pending_analyses", "Analyses waiting for their report.",
+		func() float64 { return float64(len(p.reports.snapshot())) })
+
+	for _, ecosystem := range ecosystems {
+		metrics.registerFeed(ecosystem)
+	}
+
+	if adminAddr != "" {
+		startAdminServer(adminAddr, newAdminHandler(metrics, stallAfter))
+	}
+
+	var wg sync.WaitGroup
+	for _, ecosystem := range ecosystems {
+		cutoff := initialCutoff(state, ecosystem, backfillCutoff)
+
+		wg.Add(1)
+		go func(ecosystem string, feedListener feedListener) {
+			defer wg.Done()
+			p.pollFeed(ecosystem, feedListener, cutoff)
+		}(ecosystem, feedListeners[ecosystem])
+	}
+
+	wg.Wait()
+}
+
+// Dependencies shared by the feeds
+type poller struct {
+	state  *stateStore
+	seen   *seenSet
+	filter filterConfig
+
+	typosquats *typosquatScorer
+	reports    *reportTracker
+	metrics    *pollerMetrics
+
+	submissions *submissionPool
+}
+
+// Polls of a feed whose submissions may be pending at once, more polls
+// wait for the oldest to be done
+const maxPendingBatches = 16
+
+// A poll of a feed waiting for its submissions before checkpointing
+type feedCheckpoint struct {
+	batch *submissionBatch
+
+	// Cutoffs the poll started from and reached
+	from time.Time
+	to   time.Time
+}
+
+// Poll a feed and queue its new packages for submission. Every feed keeps
+// its own cutoff, a slow registry does not hold back the others. Failed
+// polls are retried with the same cutoff after a backoff. Polling goes on
+// while the packages are submitted, the cutoff is checkpointed in the
+// background and a poll with a failed submission makes the feed poll
+// again from the checkpoint
+func (p *poller) pollFeed(ecosystem string, feedListener feedListener, cutoff time.Time) {
+	fmt.Printf("Polling %s feed every %s from %s\n", ecosystem, pollInterval, cutoff.Format(time.RFC3339))
+
+	retry := backoff{initial: backoffInitial, max: backoffMax}
+
+	checkpoints := make(chan feedCheckpoint, maxPendingBatches)
+	rewind := make(chan time.Time, 1)
+	go p.checkpointFeed(ecosystem, cutoff, checkpoints, rewind)
+
 	for {
+		select {
+		case from := <-rewind:
+			fmt.Printf("Error submitting %s packages, polling again from %s\n", ecosystem, from.Format(time.RFC3339))
+			cutoff = from
+		default:
+		}
+
+		start := time.Now()
 		packages, newCutoff, errs := feedListener.Latest(cutoff)
+		p.metrics.observePoll(ecosystem, time.Since(start), len(packages), len(errs) > 0)
+
 		if len(errs) > 0 {
-			fmt.Printf("Error polling feed: %v\n", errs)
+			delay := max(retry.next(), rateLimitDelay(errs, rateLimitPause))
+			fmt.Printf("Error polling %s feed, retrying in %s: %v\n", ecosystem, delay.Round(time.Second), errs)
+
+			time.Sleep(delay)
 			continue
 		}
 
+		retry.reset()
+
+		batch := &submissionBatch{}
+
+		filtered := 0
 		for _, pkg := range packages {
-			fmt.Printf("Type: %s Package: %s, Version: %s SchemaVer: %s\n",
-				pkg.Type, pkg.Name, pkg.Version, pkg.SchemaVer)
+			if !p.filter.keep(ecosystem, pkg) {
+				filtered++
+				continue
+			}
 
-			if err := submitForAnalysis(service, inputEcosystem, pkg); err != nil {
-				fmt.Printf("Error submitting package for analysis: %v\n", err)
+			typosquat := p.typosquats.score(ecosystem, pkg.Name)
+			if typosquatOnly && ((typosquat == nil) || (typosquat.Score < typosquatThreshold)) {
+				filtered++
+				continue
 			}
+
+			fmt.Printf("Ecosystem: %s Type: %s Package: %s, Version: %s SchemaVer: %s\n",
+				ecosystem, pkg.Type, pkg.Name, pkg.Version, pkg.SchemaVer)
+
+			if typosquat != nil {
+				fmt.Printf("Possible typosquat of %s: %s (%s, score %.2f)\n",
+					typosquat.Target, pkg.Name, typosquat.Technique, typosquat.Score)
+			}
+
+			key := packageKey(ecosystem, pkg)
+			if p.seen.seen(key) {
+				fmt.Printf("Skipping already submitted package: %s\n", key)
+				continue
+			}
+
+			p.submissions.enqueue(submission{ecosystem: ecosystem, pkg: pkg, key: key, typosquat: typosquat,
+				batch: batch})
+		}
+
+		if filtered > 0 {
+			fmt.Printf("Filtered out %d of %d %s packages\n", filtered, len(packages), ecosystem)
 		}
 
+		checkpoints <- feedCheckpoint{batch: batch, from: cutoff, to: newCutoff}
 		cutoff = newCutoff
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Checkpoint the cutoffs of the polls of a feed in order, once their
+// submissions are done. A failed poll asks the feed to poll again from the
+// checkpoint, the polls made since then are not checkpointed as they
+// started past it
+func (p *poller) checkpointFeed(ecosystem string, saved time.Time, checkpoints <-chan feedCheckpoint,
+	rewind chan<- time.Time) {
+	for checkpoint := range checkpoints {
+		ok := checkpoint.batch.wait()
+
+		switch {
+		case checkpoint.from.After(saved):
+			// Polled past a failed poll, the feed polls it again
+		case !ok:
+			select {
+			case rewind <- saved:
+			default:
+			}
+		case checkpoint.to.After(saved):
+			saved = checkpoint.to
+			if err := p.state.saveCutoff(ecosystem, saved); err != nil {
+				fmt.Printf("Error checkpointing %s feed: %v\n", ecosystem, err)
+			}
+		}
+	}
+}
+
+// Track the analysis of a submitted package version
+func (p *poller) submitted(s submission, analysisID string) {
+	p.reports.track(pendingAnalysis{
+		AnalysisID:  analysisID,
+		Ecosystem:   s.ecosystem,
+		Name:        s.pkg.Name,
+		Version:     s.pkg.Version,
+		SubmittedAt: time.Now(),
+		Typosquat:   s.typosquat,
+	})
+
+	if err := p.seen.add(s.key); err != nil {
+		fmt.Printf("Error recording submitted package: %v\n", err)
+	}
+}
+
+// Skip a package version rejected by the service on the next polls
+func (p *poller) rejected(s submission) {
+	if err := p.seen.add(s.key); err != nil {
+		fmt.Printf("Error recording rejected package: %v\n", err)
 	}
 }
 
-func submitForAnalysis(client malysisv1grpc.MalwareAnalysisServiceClient, ecosystem string, pkg *feeds.Package) error {
-	specEcosystem := packagev1.Ecosystem_ECOSYSTEM_UNSPECIFIED
-	switch ecosystem {
-	case npmEcosystem:
-		specEcosystem = packagev1.Ecosystem_ECOSYSTEM_NPM
-	case rubygemsEcosystem:
-		specEcosystem = packagev1.Ecosystem_ECOSYSTEM_RUBYGEMS
-	case pypiEcosystem:
-		specEcosystem = packagev1.Ecosystem_ECOSYSTEM_PYPI
+// Submit a package version for analysis, returning the id of the analysis
+func submitForAnalysis(ctx context.Context, client malysisv1grpc.MalwareAnalysisServiceClient, ecosystem string,
+	pkg *feeds.Package) (string, error) {
+	specEcosystem, ok := specEcosystems[ecosystem]
+	if !ok {
+		specEcosystem = packagev1.Ecosystem_ECOSYSTEM_UNSPECIFIED
 	}
 
 	req := malysisv1.AnalyzePackageRequest{
@@ -142,12 +438,12 @@ func submitForAnalysis(client malysisv1grpc.MalwareAnalysisServiceClient, ecosys
 		},
 	}
 
-	res, err := client.AnalyzePackage(context.Background(), &req)
+	res, err := client.AnalyzePackage(ctx, &req)
 	if err != nil {
-		return fmt.Errorf("error submitting package for analysis: %w", err)
+		return "", fmt.Errorf("error submitting package for analysis: %w", err)
 	}
 
 	fmt.Printf("Submitted package for analysis: %s\n", res.GetAnalysisId())
 
-	return nil
+	return res.GetAnalysisId(), nil
 }
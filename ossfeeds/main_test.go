@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckpointFeed(t *testing.T) {
+	state, err := openStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &poller{state: state}
+
+	start := time.Date(2024, 12, 5, 8, 0, 0, 0, time.UTC)
+	cutoffs := make([]time.Time, 5)
+	for i := range cutoffs {
+		cutoffs[i] = start.Add(time.Duration(i) * time.Minute)
+	}
+
+	// Batches done with the given error
+	doneBatch := func(err error) *submissionBatch {
+		batch := &submissionBatch{}
+		batch.wg.Add(1)
+		batch.done(err)
+		return batch
+	}
+
+	checkpoints := make(chan feedCheckpoint, 4)
+	checkpoints <- feedCheckpoint{batch: doneBatch(nil), from: cutoffs[0], to: cutoffs[1]}
+	checkpoints <- feedCheckpoint{batch: doneBatch(status.Error(codes.Unavailable, "down")),
+		from: cutoffs[1], to: cutoffs[2]}
+	checkpoints <- feedCheckpoint{batch: doneBatch(nil), from: cutoffs[2], to: cutoffs[3]}
+	close(checkpoints)
+
+	rewind := make(chan time.Time, 1)
+	p.checkpointFeed(npmEcosystem, cutoffs[0], checkpoints, rewind)
+
+	// The poll past the failed one is not checkpointed, the feed polls
+	// again from the checkpoint before the failure
+	if actual, _ := state.cutoff(npmEcosystem); !actual.Equal(cutoffs[1]) {
+		t.Errorf("expected cutoff %s, got %s", cutoffs[1], actual)
+	}
+
+	select {
+	case from := <-rewind:
+		if !from.Equal(cutoffs[1]) {
+			t.Errorf("expected to poll again from %s, got %s", cutoffs[1], from)
+		}
+	default:
+		t.Fatalf("expected to poll again")
+	}
+
+	checkpoints = make(chan feedCheckpoint, 1)
+	checkpoints <- feedCheckpoint{batch: doneBatch(nil), from: cutoffs[1], to: cutoffs[4]}
+	close(checkpoints)
+
+	p.checkpointFeed(npmEcosystem, cutoffs[1], checkpoints, rewind)
+
+	if actual, _ := state.cutoff(npmEcosystem); !actual.Equal(cutoffs[4]) {
+		t.Errorf("expected cutoff %s, got %s", cutoffs[4], actual)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Buckets of the poll latency histogram in seconds, feeds take from less
+// than a second to minutes when they fetch every package
+var pollDurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Metrics of the poller, exposed to Prometheus. Each instance has its own
+// registry along with the Go and process collectors
+type pollerMetrics struct {
+	registry *prometheus.Registry
+
+	packagesSeen        *prometheus.CounterVec
+	pollErrors          *prometheus.CounterVec
+	lossyFeedEvents     *prometheus.CounterVec
+	submissions         *prometheus.CounterVec
+	submissionFailures  *prometheus.CounterVec
+	submissionsRejected *prometheus.CounterVec
+	verdicts            *prometheus.CounterVec
+	pollDuration        *prometheus.HistogramVec
+
+	m           sync.Mutex
+	started     time.Time
+	lastSuccess map[string]time.Time
+}
+
+func newPollerMetrics() *pollerMetrics {
+	m := &pollerMetrics{
+		registry: prometheus.NewRegistry(),
+		packagesSeen: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_packages_seen_total",
+			Help: "Packages returned by the feeds.",
+		}, []string{"ecosystem"}),
+		pollErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_poll_errors_total",
+			Help: "Polls of the feeds that failed.",
+		}, []string{"ecosystem"}),
+		lossyFeedEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_lossy_feed_events_total",
+			Help: "Polls that may have missed packages, as reported by the feeds.",
+		}, []string{"ecosystem"}),
+		submissions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_submissions_total",
+			Help: "Packages submitted for analysis.",
+		}, []string{"ecosystem"}),
+		submissionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_submission_failures_total",
+			Help: "Submissions for analysis that failed after retries, by gRPC code.",
+		}, []string{"code"}),
+		submissionsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_submissions_rejected_total",
+			Help: "Packages rejected by the analysis service, not submitted again.",
+		}, []string{"ecosystem"}),
+		verdicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ossfeeds_verdicts_total",
+			Help: "Verdicts of the analyses.",
+		}, []string{"verdict"}),
+		pollDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ossfeeds_poll_duration_seconds",
+			Help:    "Latency of the polls of the feeds.",
+			Buckets: pollDurationBuckets,
+		}, []string{"ecosystem"}),
+		started:     time.Now(),
+		lastSuccess: make(map[string]time.Time),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.packagesSeen,
+		m.pollErrors,
+		m.lossyFeedEvents,
+		m.submissions,
+		m.submissionFailures,
+		m.submissionsRejected,
+		m.verdicts,
+		m.pollDuration,
+	)
+
+	return m
+}
+
+// Add a gauge read on every scrape
+func (m *pollerMetrics) gauge(name, help string, value func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value))
+}
+
+// Register a feed polled by the process, it is stalled until it polls
+func (m *pollerMetrics) registerFeed(ecosystem string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if _, ok := m.lastSuccess[ecosystem]; ok {
+		return
+	}
+
+	m.lastSuccess[ecosystem] = time.Time{}
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "ossfeeds_last_successful_poll_timestamp_seconds",
+		Help:        "Time of the last successful poll of each feed, 0 before the first one.",
+		ConstLabels: prometheus.Labels{"ecosystem": ecosystem},
+	}, func() float64 {
+		m.m.Lock()
+		defer m.m.Unlock()
+
+		if last := m.lastSuccess[ecosystem]; !last.IsZero() {
+			return float64(last.UnixMilli()) / 1000
+		}
+
+		return 0
+	}))
+}
+
+// Record a poll of a feed, successful when there are no errors
+func (m *pollerMetrics) observePoll(ecosystem string, duration time.Duration, packages int, failed bool) {
+	m.pollDuration.WithLabelValues(ecosystem).Observe(duration.Seconds())
+	m.packagesSeen.WithLabelValues(ecosystem).Add(float64(packages))
+
+	if failed {
+		m.pollErrors.WithLabelValues(ecosystem).Inc()
+		return
+	}
+
+	m.m.Lock()
+	m.lastSuccess[ecosystem] = time.Now()
+	m.m.Unlock()
+}
+
+// Feeds without a successful poll for longer than the limit, with the
+// time since their last successful poll or the start of the process
+func (m *pollerMetrics) stalledFeeds(limit time.Duration, now time.Time) map[string]time.Duration {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	stalled := make(map[string]time.Duration)
+	for ecosystem, last := range m.lastSuccess {
+		if last.IsZero() {
+			last = m.started
+		}
+
+		if since := now.Sub(last); since > limit {
+			stalled[ecosystem] = since
+		}
+	}
+
+	return stalled
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+// Exponential backoff with jitter between failed polls of a feed. Every
+// failure doubles the delay up to the maximum, the jitter spreads the
+// retries of feeds failing at the same time
+type backoff struct {
+	initial  time.Duration
+	max      time.Duration
+	failures int
+}
+
+// Delay before the next retry, counting one more failure
+func (b *backoff) next() time.Duration {
+	delay := b.initial
+	for i := 0; (i < b.failures) && (delay < b.max); i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, b.max)
+	b.failures++
+
+	// Equal jitter, the delay is at least half of the exponential one
+	if half := delay / 2; half > 0 {
+		delay = half + rand.N(half)
+	}
+
+	return delay
+}
+
+// Forget the failures after a successful poll
+func (b *backoff) reset() {
+	b.failures = 0
+}
+
+// Delay asked by a rate limited feed, zero when none of the errors is a
+// rate limit. The feeds build their own HTTP clients and give no way to
+// replace them, so Retry-After never reaches us and a rate limited feed
+// pauses for the default time
+func rateLimitDelay(errs []error, defaultPause time.Duration) time.Duration {
+	delay := time.Duration(0)
+	for _, err := range errs {
+		// Errors of a package do not unwrap to their cause
+		var pollErr feeds.PackagePollError
+		if errors.As(err, &pollErr) {
+			err = pollErr.Err
+		}
+
+		if isRateLimitStatus(err) {
+			delay = defaultPause
+		}
+	}
+
+	return delay
+}
+
+// Check whether a feed failed on a 429 or 503 response, feeds report the
+// status in the message of the error only
+func isRateLimitStatus(err error) bool {
+	if (err == nil) || !errors.Is(err, utils.ErrUnsuccessfulRequest) {
+		return false
+	}
+
+	message := err.Error()
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		if strings.Contains(message, fmt.Sprintf("%s: %d ", utils.ErrUnsuccessfulRequest, status)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+func TestBackoff(t *testing.T) {
+	b := backoff{initial: time.Second, max: 8 * time.Second}
+
+	// Equal jitter keeps each delay between half and all of the
+	// exponential one
+	for _, exponential := range []time.Duration{1, 2, 4, 8, 8} {
+		exponential *= time.Second
+
+		delay := b.next()
+		if (delay < exponential/2) || (delay >= exponential) {
+			t.Errorf("expected a delay in [%s, %s), got %s", exponential/2, exponential, delay)
+		}
+	}
+
+	b.reset()
+	if delay := b.next(); delay >= time.Second {
+		t.Errorf("expected the initial delay after a reset, got %s", delay)
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	statusErr := fmt.Errorf("failed to fetch npm package version data: %w",
+		fmt.Errorf("%w: %v", utils.ErrUnsuccessfulRequest, "429 Too Many Requests"))
+	unavailableErr := fmt.Errorf("%w: %v", utils.ErrUnsuccessfulRequest, "503 Service Unavailable")
+	notFoundErr := fmt.Errorf("%w: %v", utils.ErrUnsuccessfulRequest, "404 Not Found")
+
+	cases := []struct {
+		name string
+		errs []error
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"no rate limit", []error{errors.New("timeout"), notFoundErr}, 0, 0},
+		{"unavailable", []error{unavailableErr}, 30 * time.Second, 30 * time.Second},
+		{"status of a package", []error{feeds.PackagePollError{Name: "lodash", Err: statusErr}},
+			30 * time.Second, 30 * time.Second},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if delay := rateLimitDelay(test.errs, 30*time.Second); (delay < test.min) || (delay > test.max) {
+				t.Errorf("expected a delay in [%s, %s], got %s", test.min, test.max, delay)
+			}
+		})
+	}
+}
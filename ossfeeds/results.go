@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"buf.build/gen/go/safedep/api/grpc/go/safedep/services/malysis/v1/malysisv1grpc"
+	malysisv1pb "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/messages/malysis/v1"
+	malysisv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/malysis/v1"
+)
+
+// Verdicts of an analysis
+const (
+	verdictMalicious  = "malicious"
+	verdictSuspicious = "suspicious"
+	verdictClean      = "clean"
+
+	// The analysis failed or did not complete in time
+	verdictUnknown = "unknown"
+)
+
+// An analysis submitted and waiting for its report
+type pendingAnalysis struct {
+	AnalysisID  string    `json:"analysis_id"`
+	Ecosystem   string    `json:"ecosystem"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	SubmittedAt time.Time `json:"submitted_at"`
+
+	Typosquat *typosquatMatch `json:"typosquat,omitempty"`
+}
+
+// Outcome of the analysis of a package version
+type analysisResult struct {
+	AnalysisID  string    `json:"analysis_id"`
+	Ecosystem   string    `json:"ecosystem"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Verdict     string    `json:"verdict"`
+	Confidence  string    `json:"confidence,omitempty"`
+	Summary     string    `json:"summary,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	CompletedAt time.Time `json:"completed_at"`
+
+	// Popular package the package likely squats
+	Typosquat *typosquatMatch `json:"typosquat,omitempty"`
+}
+
+// Verdict of a completed report. Malware inferred with high confidence is
+// malicious, with a lower confidence it is suspicious
+func reportVerdict(report *malysisv1pb.Report) string {
+	inference := report.GetInference()
+	switch {
+	case !inference.GetIsMalware():
+		return verdictClean
+	case inference.GetConfidence() == malysisv1pb.Report_Evidence_CONFIDENCE_HIGH:
+		return verdictMalicious
+	default:
+		return verdictSuspicious
+	}
+}
+
+// Tracks submitted analyses, polling the service for their report until
+// it completes and recording the verdict. Pending analyses are kept in the
+// state store, a restart resumes tracking them
+type reportTracker struct {
+	service  malysisv1grpc.MalwareAnalysisServiceClient
+	state    *stateStore
+	interval time.Duration
+	timeout  time.Duration
+
+	// Deadline of a call to the service, a hung call would hold back the
+	// reports of every other analysis
+	callTimeout time.Duration
+
+	// Called with the outcome of each analysis. An error keeps the
+	// analysis pending, its outcome is recorded again on the next round
+	record func(analysisResult) error
+
+	m       sync.Mutex
+	pending map[string]pendingAnalysis
+}
+
+func newReportTracker(service malysisv1grpc.MalwareAnalysisServiceClient, state *stateStore,
+	interval, timeout, callTimeout time.Duration, record func(analysisResult) error) *reportTracker {
+	t := &reportTracker{
+		service:     service,
+		state:       state,
+		interval:    interval,
+		timeout:     timeout,
+		callTimeout: callTimeout,
+		record:      record,
+		pending:     make(map[string]pendingAnalysis),
+	}
+
+	for _, analysis := range state.pendingAnalyses() {
+		t.pending[analysis.AnalysisID] = analysis
+	}
+
+	return t
+}
+
+// Start tracking a submitted analysis
+func (t *reportTracker) track(analysis pendingAnalysis) {
+	t.m.Lock()
+	t.pending[analysis.AnalysisID] = analysis
+	t.m.Unlock()
+
+	t.state.savePending(analysis)
+}
+
+// Poll the reports of the pending analyses every interval, writing the
+// pending analyses after each round
+func (t *reportTracker) run() {
+	for {
+		for _, analysis := range t.snapshot() {
+			t.check(analysis)
+		}
+
+		if err := t.state.flush(); err != nil {
+			fmt.Printf("Error saving pending analyses: %v\n", err)
+		}
+
+		time.Sleep(t.interval)
+	}
+}
+
+// Pending analyses, oldest first
+func (t *reportTracker) snapshot() []pendingAnalysis {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	pending := make([]pendingAnalysis, 0, len(t.pending))
+	for _, analysis := range t.pending {
+		pending = append(pending, analysis)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].SubmittedAt.Before(pending[j].SubmittedAt)
+	})
+
+	return pending
+}
+
+// Check whether an analysis waited for its report longer than the timeout
+func (t *reportTracker) expired(analysis pendingAnalysis) bool {
+	return (t.timeout > 0) && (time.Since(analysis.SubmittedAt) >= t.timeout)
+}
+
+// Fetch the report of an analysis, recording the verdict once it is
+// complete, failed or timed out. Analyses whose report keeps failing, for
+// example once purged by the service, time out as well. The analysis stays
+// pending until its verdict is recorded
+func (t *reportTracker) check(analysis pendingAnalysis) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.callTimeout)
+	defer cancel()
+
+	res, err := t.service.GetAnalysisReport(ctx, &malysisv1.GetAnalysisReportRequest{
+		AnalysisId: analysis.AnalysisID,
+	})
+
+	result := analysisResult{
+		AnalysisID:  analysis.AnalysisID,
+		Ecosystem:   analysis.Ecosystem,
+		Name:        analysis.Name,
+		Version:     analysis.Version,
+		SubmittedAt: analysis.SubmittedAt,
+		CompletedAt: time.Now(),
+		Typosquat:   analysis.Typosquat,
+	}
+
+	switch {
+	case err != nil:
+		fmt.Printf("Error getting analysis report %s: %v\n", analysis.AnalysisID, err)
+		if !t.expired(analysis) {
+			return
+		}
+
+		result.Verdict = verdictUnknown
+		result.Summary = fmt.Sprintf("no report after %s: %v", t.timeout, err)
+	case res.GetStatus() == malysisv1.AnalysisStatus_ANALYSIS_STATUS_COMPLETED:
+		inference := res.GetReport().GetInference()
+
+		result.Verdict = reportVerdict(res.GetReport())
+		result.Summary = inference.GetSummary()
+		if inference.GetIsMalware() {
+			result.Confidence = inference.GetConfidence().String()
+		}
+	case res.GetStatus() == malysisv1.AnalysisStatus_ANALYSIS_STATUS_FAILED:
+		result.Verdict = verdictUnknown
+		result.Summary = "analysis failed"
+	default:
+		if !t.expired(analysis) {
+			return
+		}
+
+		result.Verdict = verdictUnknown
+		result.Summary = fmt.Sprintf("no report after %s", t.timeout)
+	}
+
+	if err := t.record(result); err != nil {
+		fmt.Printf("Error recording verdict of analysis %s: %v\n", analysis.AnalysisID, err)
+		return
+	}
+
+	t.m.Lock()
+	delete(t.pending, analysis.AnalysisID)
+	t.m.Unlock()
+
+	t.state.removePending(analysis.AnalysisID)
+}
+
+// Print the outcome of an analysis
+func printResult(result analysisResult) {
+	fmt.Printf("Verdict: %s Ecosystem: %s Package: %s, Version: %s Analysis: %s\n",
+		result.Verdict, result.Ecosystem, result.Name, result.Version, result.AnalysisID)
+}
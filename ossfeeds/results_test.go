@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"buf.build/gen/go/safedep/api/grpc/go/safedep/services/malysis/v1/malysisv1grpc"
+	malysisv1pb "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/messages/malysis/v1"
+	malysisv1 "buf.build/gen/go/safedep/api/protocolbuffers/go/safedep/services/malysis/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Analysis service answering report calls with a function
+type fakeReportService struct {
+	malysisv1grpc.MalwareAnalysisServiceClient
+
+	report func(ctx context.Context) (*malysisv1.GetAnalysisReportResponse, error)
+}
+
+func (s *fakeReportService) GetAnalysisReport(ctx context.Context, _ *malysisv1.GetAnalysisReportRequest,
+	_ ...grpc.CallOption) (*malysisv1.GetAnalysisReportResponse, error) {
+	return s.report(ctx)
+}
+
+func TestReportTrackerErrors(t *testing.T) {
+	cases := []struct {
+		name      string
+		submitted time.Duration
+		report    func(ctx context.Context) (*malysisv1.GetAnalysisReportResponse, error)
+		verdict   string
+	}{
+		{"hung call within the timeout", 0,
+			func(ctx context.Context) (*malysisv1.GetAnalysisReportResponse, error) {
+				<-ctx.Done()
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}, ""},
+		{"failing call within the timeout", 0,
+			func(context.Context) (*malysisv1.GetAnalysisReportResponse, error) {
+				return nil, status.Error(codes.NotFound, "purged")
+			}, ""},
+		{"failing call after the timeout", 2 * time.Hour,
+			func(context.Context) (*malysisv1.GetAnalysisReportResponse, error) {
+				return nil, status.Error(codes.NotFound, "purged")
+			}, verdictUnknown},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			state, err := openStateStore("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results := make([]analysisResult, 0)
+			tracker := newReportTracker(&fakeReportService{report: test.report}, state,
+				time.Minute, time.Hour, 50*time.Millisecond, func(result analysisResult) error {
+					results = append(results, result)
+					return nil
+				})
+
+			analysis := pendingAnalysis{AnalysisID: "a1", Ecosystem: npmEcosystem, Name: "lodash",
+				SubmittedAt: time.Now().Add(-test.submitted)}
+			tracker.track(analysis)
+
+			done := make(chan struct{})
+			go func() {
+				tracker.check(analysis)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("report call without deadline")
+			}
+
+			if test.verdict == "" {
+				if (len(results) != 0) || (len(tracker.snapshot()) != 1) {
+					t.Errorf("expected the analysis still pending, got %v", results)
+				}
+
+				return
+			}
+
+			if (len(results) != 1) || (results[0].Verdict != test.verdict) {
+				t.Fatalf("expected a %s verdict, got %v", test.verdict, results)
+			}
+
+			if (len(tracker.snapshot()) != 0) || (len(state.pendingAnalyses()) != 0) {
+				t.Errorf("expected the analysis no longer pending")
+			}
+		})
+	}
+}
+
+func TestReportTrackerCompleted(t *testing.T) {
+	state, err := openStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &fakeReportService{
+		report: func(context.Context) (*malysisv1.GetAnalysisReportResponse, error) {
+			return &malysisv1.GetAnalysisReportResponse{
+				Status: malysisv1.AnalysisStatus_ANALYSIS_STATUS_COMPLETED,
+				Report: &malysisv1pb.Report{
+					Inference: &malysisv1pb.Report_Inference{
+						IsMalware:  true,
+						Confidence: malysisv1pb.Report_Evidence_CONFIDENCE_HIGH,
+						Summary:    "exfiltrates environment variables",
+					},
+				},
+			}, nil
+		},
+	}
+
+	results := make([]analysisResult, 0)
+	tracker := newReportTracker(service, state, time.Minute, time.Hour, time.Second,
+		func(result analysisResult) error {
+			results = append(results, result)
+			return nil
+		})
+
+	analysis := pendingAnalysis{AnalysisID: "a1", Ecosystem: npmEcosystem, Name: "lodahs",
+		Version: "1.0.0", SubmittedAt: time.Now()}
+	tracker.track(analysis)
+	tracker.check(analysis)
+
+	if len(results) != 1 {
+		t.Fatalf("expected a single result, got %v", results)
+	}
+
+	result := results[0]
+	if (result.Verdict != verdictMalicious) || (result.Summary != "exfiltrates environment variables") ||
+		(result.Confidence != "CONFIDENCE_HIGH") {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if (len(tracker.snapshot()) != 0) || (len(state.pendingAnalyses()) != 0) {
+		t.Errorf("expected the analysis no longer pending")
+	}
+}
+
+func TestReportTrackerFailingSink(t *testing.T) {
+	state, err := openStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &fakeReportService{
+		report: func(context.Context) (*malysisv1.GetAnalysisReportResponse, error) {
+			return &malysisv1.GetAnalysisReportResponse{
+				Status: malysisv1.AnalysisStatus_ANALYSIS_STATUS_COMPLETED,
+				Report: &malysisv1pb.Report{},
+			}, nil
+		},
+	}
+
+	publisher := &memoryPublisher{messages: make(map[string][]string), err: io.ErrClosedPipe}
+	sinks := multiSink{newPublisherSink(publisher, "verdicts")}
+
+	tracker := newReportTracker(service, state, time.Minute, time.Hour, time.Second,
+		func(result analysisResult) error {
+			return sinks.Write(context.Background(), result)
+		})
+
+	analysis := pendingAnalysis{AnalysisID: "a1", Ecosystem: npmEcosystem, Name: "lodash",
+		Version: "4.17.21", SubmittedAt: time.Now()}
+	tracker.track(analysis)
+
+	// A verdict the sinks do not accept stays pending
+	tracker.check(analysis)
+
+	if (len(tracker.snapshot()) != 1) || (len(state.pendingAnalyses()) != 1) {
+		t.Fatalf("expected the analysis still pending")
+	}
+
+	// And is delivered on the next round
+	publisher.err = nil
+	tracker.check(analysis)
+
+	if len(publisher.messages["verdicts"]) != 1 {
+		t.Errorf("expected the verdict delivered, got %v", publisher.messages)
+	}
+
+	if (len(tracker.snapshot()) != 0) || (len(state.pendingAnalyses()) != 0) {
+		t.Errorf("expected the analysis no longer pending")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header holding the HMAC-SHA256 of the body of webhook requests
+const webhookSignatureHeader = "X-Ossfeeds-Signature-256"
+
+// Destination of analysis results
+type resultSink interface {
+	Write(ctx context.Context, result analysisResult) error
+	Close() error
+}
+
+// Results as JSON lines appended to a file, or written to stdout
+type jsonlSink struct {
+	m       sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	encoder *json.Encoder
+}
+
+// Open a JSON lines sink, "-" writes to stdout
+func newJSONLSink(path string) (*jsonlSink, error) {
+	if path == "-" {
+		return &jsonlSink{w: os.Stdout, encoder: json.NewEncoder(os.Stdout)}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening results file: %w", err)
+	}
+
+	return &jsonlSink{w: file, closer: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (s *jsonlSink) Write(_ context.Context, result analysisResult) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.encoder.Encode(result)
+}
+
+func (s *jsonlSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
+
+// Post a JSON body, failing on a non 2xx response
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if (res.StatusCode < 200) || (res.StatusCode > 299) {
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+
+	return nil
+}
+
+// Results posted as JSON to a generic webhook. With a secret, the body is
+// signed with HMAC-SHA256 so that the receiver can authenticate it
+type webhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func newWebhookSink(url, secret string) *webhookSink {
+	return &webhookSink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Signature of a webhook body, as sent in the signature header
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookSink) Write(ctx context.Context, result analysisResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if len(s.secret) > 0 {
+		header.Set(webhookSignatureHeader, webhookSignature(s.secret, body))
+	}
+
+	if err := postJSON(ctx, s.client, s.url, body, header); err != nil {
+		return fmt.Errorf("error posting result to webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
+
+// Results posted as messages to a Slack compatible incoming webhook. Clean
+// verdicts are not posted, the channel is for the packages to look at
+type slackSink struct {
+	url    string
+	client *http.Client
+}
+
+func newSlackSink(url string) *slackSink {
+	return &slackSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Text of the message of a result
+func slackText(result analysisResult) string {
+	text := fmt.Sprintf("*%s* %s package `%s@%s` (analysis `%s`)",
+		strings.ToUpper(result.Verdict), result.Ecosystem, result.Name, result.Version, result.AnalysisID)
+
+	if result.Typosquat != nil {
+		text += fmt.Sprintf("\nPossible typosquat of `%s` (%s, score %.2f)",
+			result.Typosquat.Target, result.Typosquat.Technique, result.Typosquat.Score)
+	}
+
+	if result.Summary != "" {
+		text += "\n" + result.Summary
+	}
+
+	return text
+}
+
+func (s *slackSink) Write(ctx context.Context, result analysisResult) error {
+	if result.Verdict == verdictClean {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{"text": slackText(result)})
+	if err != nil {
+		return err
+	}
+
+	if err := postJSON(ctx, s.client, s.url, body, nil); err != nil {
+		return fmt.Errorf("error posting result to slack: %w", err)
+	}
+
+	return nil
+}
+
+func (s *slackSink) Close() error {
+	return nil
+}
+
+// Publisher of messages to a topic of a message queue, such as a NATS
+// subject or a Kafka topic. The key orders the messages of a package
+type messagePublisher interface {
+	Publish(ctx context.Context, topic string, key string, value []byte) error
+	Close() error
+}
+
+// Results published as JSON messages keyed by package version
+type publisherSink struct {
+	publisher messagePublisher
+	topic     string
+}
+
+func newPublisherSink(publisher messagePublisher, topic string) *publisherSink {
+	return &publisherSink{publisher: publisher, topic: topic}
+}
+
+func (s *publisherSink) Write(ctx context.Context, result analysisResult) error {
+	value, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	key := result.Ecosystem + "/" + result.Name + "@" + result.Version
+	if err := s.publisher.Publish(ctx, s.topic, key, value); err != nil {
+		return fmt.Errorf("error publishing result to %s: %w", s.topic, err)
+	}
+
+	return nil
+}
+
+func (s *publisherSink) Close() error {
+	return s.publisher.Close()
+}
+
+// Publisher producing to Kafka through the REST proxy API v2
+type kafkaRESTPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func newKafkaRESTPublisher(url string) *kafkaRESTPublisher {
+	return &kafkaRESTPublisher{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, topic string, key string, value []byte) error {
+	type record struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+
+	body, err := json.Marshal(map[string][]record{
+		"records": {{Key: key, Value: value}},
+	})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+
+	return postJSON(ctx, p.client, p.url+"/topics/"+url.PathEscape(topic), body, header)
+}
+
+func (p *kafkaRESTPublisher) Close() error {
+	return nil
+}
+
+// Results written to every sink of a list
+type multiSink []resultSink
+
+func (s multiSink) Write(ctx context.Context, result analysisResult) error {
+	errs := make([]error, 0)
+	for _, sink := range s {
+		if err := sink.Write(ctx, result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s multiSink) Close() error {
+	errs := make([]error, 0)
+	for _, sink := range s {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
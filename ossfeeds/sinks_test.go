@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testResult = analysisResult{
+	AnalysisID:  "01JF",
+	Ecosystem:   npmEcosystem,
+	Name:        "expresss",
+	Version:     "1.0.0",
+	Verdict:     verdictMalicious,
+	Confidence:  "CONFIDENCE_HIGH",
+	Summary:     "Downloads and runs a binary on install",
+	SubmittedAt: time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC),
+	CompletedAt: time.Date(2024, 12, 1, 10, 5, 0, 0, time.UTC),
+}
+
+// Local stand-in of an HTTP endpoint, recording the requests it receives
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newRecordingServer(t *testing.T, status int) (*httptest.Server, *[]recordedRequest) {
+	requests := make([]recordedRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request: %v", err)
+		}
+
+		requests = append(requests, recordedRequest{path: r.URL.Path, header: r.Header, body: body})
+		w.WriteHeader(status)
+	}))
+
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestJSONLSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+
+	sink, err := newJSONLSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(context.Background(), testResult); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+
+	var result analysisResult
+	if err := json.Unmarshal([]byte(lines[0]), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result != testResult {
+		t.Errorf("expected %+v, got %+v", testResult, result)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	server, requests := newRecordingServer(t, http.StatusNoContent)
+
+	sink := newWebhookSink(server.URL, "secret")
+	if err := sink.Write(context.Background(), testResult); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*requests))
+	}
+
+	req := (*requests)[0]
+	if expected := webhookSignature([]byte("secret"), req.body); req.header.Get(webhookSignatureHeader) != expected {
+		t.Errorf("signature: expected %s, got %s", expected, req.header.Get(webhookSignatureHeader))
+	}
+
+	if req.header.Get(webhookSignatureHeader) == webhookSignature([]byte("other"), req.body) {
+		t.Errorf("signature does not depend on the secret")
+	}
+
+	var result analysisResult
+	if err := json.Unmarshal(req.body, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.AnalysisID != testResult.AnalysisID {
+		t.Errorf("expected analysis %s, got %s", testResult.AnalysisID, result.AnalysisID)
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		server, requests := newRecordingServer(t, http.StatusOK)
+		if err := newWebhookSink(server.URL, "").Write(context.Background(), testResult); err != nil {
+			t.Fatal(err)
+		}
+
+		if signature := (*requests)[0].header.Get(webhookSignatureHeader); signature != "" {
+			t.Errorf("unexpected signature %s", signature)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server, _ := newRecordingServer(t, http.StatusInternalServerError)
+		if err := newWebhookSink(server.URL, "secret").Write(context.Background(), testResult); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestSlackSink(t *testing.T) {
+	server, requests := newRecordingServer(t, http.StatusOK)
+	sink := newSlackSink(server.URL)
+
+	clean := testResult
+	clean.Verdict = verdictClean
+
+	for _, result := range []analysisResult{testResult, clean} {
+		if err := sink.Write(context.Background(), result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("expected only the malicious result posted, got %d requests", len(*requests))
+	}
+
+	var message map[string]string
+	if err := json.Unmarshal((*requests)[0].body, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "*MALICIOUS* npm package `expresss@1.0.0` (analysis `01JF`)\nDownloads and runs a binary on install"
+	if message["text"] != expected {
+		t.Errorf("expected %q, got %q", expected, message["text"])
+	}
+}
+
+func TestKafkaRESTPublisher(t *testing.T) {
+	server, requests := newRecordingServer(t, http.StatusOK)
+
+	sink := newPublisherSink(newKafkaRESTPublisher(server.URL+"/"), "package-verdicts")
+	if err := sink.Write(context.Background(), testResult); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*requests)[0]
+	if req.path != "/topics/package-verdicts" {
+		t.Errorf("unexpected path %s", req.path)
+	}
+
+	if contentType := req.header.Get("Content-Type"); contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("unexpected content type %s", contentType)
+	}
+
+	var body struct {
+		Records []struct {
+			Key   string         `json:"key"`
+			Value analysisResult `json:"value"`
+		} `json:"records"`
+	}
+
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(body.Records))
+	}
+
+	if body.Records[0].Key != "npm/expresss@1.0.0" {
+		t.Errorf("unexpected key %s", body.Records[0].Key)
+	}
+
+	if body.Records[0].Value != testResult {
+		t.Errorf("expected %+v, got %+v", testResult, body.Records[0].Value)
+	}
+}
+
+// Publisher keeping the messages in memory
+type memoryPublisher struct {
+	messages map[string][]string
+	err      error
+}
+
+func (p *memoryPublisher) Publish(_ context.Context, topic string, key string, _ []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.messages[topic] = append(p.messages[topic], key)
+	return nil
+}
+
+func (p *memoryPublisher) Close() error {
+	return nil
+}
+
+func TestMultiSink(t *testing.T) {
+	delivered := &memoryPublisher{messages: make(map[string][]string)}
+	failing := &memoryPublisher{err: io.ErrClosedPipe}
+
+	sink := multiSink{
+		newPublisherSink(failing, "verdicts"),
+		newPublisherSink(delivered, "verdicts"),
+	}
+
+	if err := sink.Write(context.Background(), testResult); err == nil {
+		t.Errorf("expected the error of the failing sink")
+	}
+
+	if len(delivered.messages["verdicts"]) != 1 {
+		t.Errorf("expected the result delivered past a failing sink, got %v", delivered.messages)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State of the poller kept across restarts
+type pollerState struct {
+	// Cutoff of each feed, packages created before it were handled
+	Cutoffs map[string]time.Time `json:"cutoffs"`
+
+	// Analyses waiting for their report, by analysis id
+	Pending map[string]pendingAnalysis `json:"pending,omitempty"`
+}
+
+// Local file holding the state of the poller. Feeds checkpoint their cutoff
+// after each batch, so that a restart resumes where the poller stopped. The
+// file is replaced atomically, a crash leaves the previous checkpoint.
+// Changes of the pending analyses are only written with the next
+// checkpoint or flush, a write per report would rewrite the whole file
+type stateStore struct {
+	path string
+
+	m     sync.Mutex
+	state pollerState
+
+	// Changes not written to the file yet
+	dirty bool
+}
+
+// Open the state file, a missing file is an empty state. An empty path
+// keeps the state in memory only
+func openStateStore(path string) (*stateStore, error) {
+	store := &stateStore{
+		path: path,
+		state: pollerState{
+			Cutoffs: make(map[string]time.Time),
+			Pending: make(map[string]pendingAnalysis),
+		},
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		return nil, fmt.Errorf("error decoding state %s: %w", path, err)
+	}
+
+	if store.state.Cutoffs == nil {
+		store.state.Cutoffs = make(map[string]time.Time)
+	}
+
+	if store.state.Pending == nil {
+		store.state.Pending = make(map[string]pendingAnalysis)
+	}
+
+	return store, nil
+}
+
+// Cutoff checkpointed by a feed
+func (s *stateStore) cutoff(ecosystem string) (time.Time, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	cutoff, ok := s.state.Cutoffs[ecosystem]
+	return cutoff, ok
+}
+
+// Checkpoint the cutoff of a feed
+func (s *stateStore) saveCutoff(ecosystem string, cutoff time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.state.Cutoffs[ecosystem] = cutoff
+	return s.write()
+}
+
+// Analyses waiting for their report when the state was saved
+func (s *stateStore) pendingAnalyses() []pendingAnalysis {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	pending := make([]pendingAnalysis, 0, len(s.state.Pending))
+	for _, analysis := range s.state.Pending {
+		pending = append(pending, analysis)
+	}
+
+	return pending
+}
+
+// Record an analysis waiting for its report
+func (s *stateStore) savePending(analysis pendingAnalysis) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.state.Pending[analysis.AnalysisID] = analysis
+	s.dirty = true
+}
+
+// Forget an analysis once its verdict is recorded
+func (s *stateStore) removePending(analysisID string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.state.Pending, analysisID)
+	s.dirty = true
+}
+
+// Write the changes made since the last write
+func (s *stateStore) flush() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	return s.write()
+}
+
+// Replace the state file by a complete copy of the state
+func (s *stateStore) write() error {
+	if s.path == "" {
+		s.dirty = false
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("error writing state: %w", err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// Write a file through a temporary file renamed over it, readers see
+// either the previous or the new content
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Cutoff a feed starts from. A backfill overrides the checkpoint, feeds
+// without either start an hour back
+func initialCutoff(store *stateStore, ecosystem string, backfillFrom time.Time) time.Time {
+	if !backfillFrom.IsZero() {
+		return backfillFrom
+	}
+
+	if cutoff, ok := store.cutoff(ecosystem); ok {
+		return cutoff
+	}
+
+	return time.Now().Add(-time.Hour * 1)
+}
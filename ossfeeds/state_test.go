@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	store, err := openStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.cutoff(npmEcosystem); ok {
+		t.Errorf("unexpected cutoff in a missing state file")
+	}
+
+	cutoff := time.Date(2024, 12, 5, 8, 0, 0, 0, time.UTC)
+	if err := store.saveCutoff(npmEcosystem, cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a1", "a2"} {
+		analysis := pendingAnalysis{AnalysisID: id, Ecosystem: npmEcosystem, Name: "lodash"}
+		store.savePending(analysis)
+	}
+
+	store.removePending("a1")
+
+	// Pending analyses wait for the next write
+	unflushed, err := openStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending := unflushed.pendingAnalyses(); len(pending) != 0 {
+		t.Errorf("expected no pending analysis before a flush, got %v", pending)
+	}
+
+	if err := store.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart resumes from the checkpoint
+	store, err = openStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, ok := store.cutoff(npmEcosystem); !ok || !actual.Equal(cutoff) {
+		t.Errorf("expected cutoff %s, got %s", cutoff, actual)
+	}
+
+	pending := store.pendingAnalyses()
+	if (len(pending) != 1) || (pending[0].AnalysisID != "a2") {
+		t.Errorf("expected analysis a2 pending, got %v", pending)
+	}
+
+	// Writes go through a temporary file renamed over the state
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected the state file only, got %v", entries)
+	}
+}
+
+func TestStateStoreInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openStateStore(path); err == nil {
+		t.Errorf("expected an error for an invalid state file")
+	}
+}
+
+func TestInitialCutoff(t *testing.T) {
+	store, err := openStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint := time.Date(2024, 12, 5, 8, 0, 0, 0, time.UTC)
+	if err := store.saveCutoff(npmEcosystem, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	backfill := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if actual := initialCutoff(store, npmEcosystem, time.Time{}); !actual.Equal(checkpoint) {
+		t.Errorf("expected the checkpoint %s, got %s", checkpoint, actual)
+	}
+
+	if actual := initialCutoff(store, npmEcosystem, backfill); !actual.Equal(backfill) {
+		t.Errorf("expected the backfill %s, got %s", backfill, actual)
+	}
+
+	since := time.Since(initialCutoff(store, pypiEcosystem, time.Time{}))
+	if (since < time.Hour) || (since > time.Hour+time.Minute) {
+		t.Errorf("expected a feed without checkpoint to start an hour back, got %s", since)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Techniques of a typosquat, from the most to the least likely
+const (
+	typosquatSeparator = "separator"
+	typosquatHomoglyph = "homoglyph"
+	typosquatScope     = "scope"
+	typosquatKeyboard  = "keyboard"
+	typosquatEdit      = "edit_distance"
+)
+
+// Score of a typosquat by technique, names up to two edits away from a
+// long popular name score lower
+var typosquatScores = map[string]float64{
+	typosquatSeparator: 0.9,
+	typosquatHomoglyph: 0.9,
+	typosquatScope:     0.85,
+	typosquatKeyboard:  0.85,
+	typosquatEdit:      0.75,
+}
+
+const (
+	typosquatFarEditScore = 0.5
+
+	// Popular names shorter than this are not compared by edit distance,
+	// most short names are one edit away from another one
+	typosquatMinLength = 4
+
+	// Popular names from this length are compared up to two edits away
+	typosquatFarEditLength = 8
+)
+
+// Popular packages of each ecosystem unless a corpus is configured
+var defaultTyposquatCorpus = map[string][]string{
+	npmEcosystem: {"react", "react-dom", "lodash", "express", "axios", "chalk", "commander", "debug",
+		"moment", "request", "typescript", "webpack", "eslint", "prettier", "jquery", "vue", "next",
+		"dotenv", "uuid", "yargs", "@babel/core", "@types/node", "@angular/core", "@aws-sdk/client-s3"},
+	pypiEcosystem: {"requests", "numpy", "pandas", "urllib3", "boto3", "botocore", "setuptools", "django",
+		"flask", "pyyaml", "cryptography", "python-dateutil", "beautifulsoup4", "colorama", "matplotlib",
+		"scikit-learn", "tensorflow", "pytorch", "selenium", "pillow"},
+	rubygemsEcosystem: {"rails", "rake", "bundler", "rspec", "nokogiri", "activesupport", "json", "rack",
+		"devise", "sidekiq", "puma", "faraday"},
+	cratesEcosystem: {"serde", "serde_json", "tokio", "rand", "clap", "syn", "quote", "regex", "reqwest",
+		"anyhow", "thiserror", "log"},
+	goEcosystem: {"github.com/stretchr/testify", "github.com/sirupsen/logrus", "github.com/spf13/cobra",
+		"github.com/gin-gonic/gin", "github.com/gorilla/mux", "google.golang.org/grpc"},
+	nugetEcosystem: {"Newtonsoft.Json", "Serilog", "AutoMapper", "Dapper", "Moq", "xunit", "NUnit",
+		"Polly", "MediatR", "FluentValidation"},
+	mavenEcosystem: {"org.apache.logging.log4j:log4j-core", "com.google.guava:guava",
+		"com.fasterxml.jackson.core:jackson-databind", "org.springframework:spring-core",
+		"junit:junit", "org.slf4j:slf4j-api"},
+	packagistEcosystem: {"symfony/console", "laravel/framework", "guzzlehttp/guzzle", "monolog/monolog",
+		"phpunit/phpunit", "doctrine/orm"},
+}
+
+// Popular name a package name likely squats
+type typosquatMatch struct {
+	Target    string  `json:"target"`
+	Technique string  `json:"technique"`
+	Score     float64 `json:"score"`
+}
+
+// Scores package names against popular names of their ecosystem
+type typosquatScorer struct {
+	corpus map[string][]string
+}
+
+// Scorer of the default corpus, with the ecosystems of a corpus file, a
+// JSON object of popular names by ecosystem, replacing the default ones
+func newTyposquatScorer(file string) (*typosquatScorer, error) {
+	corpus := make(map[string][]string)
+	for ecosystem, names := range defaultTyposquatCorpus {
+		corpus[ecosystem] = names
+	}
+
+	if file == "" {
+		return &typosquatScorer{corpus: corpus}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading typosquat corpus: %w", err)
+	}
+
+	var configured map[string][]string
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("error decoding typosquat corpus %s: %w", file, err)
+	}
+
+	for ecosystem, names := range configured {
+		if _, ok := specEcosystems[ecosystem]; !ok {
+			return nil, fmt.Errorf("typosquat corpus: unsupported ecosystem: %s", ecosystem)
+		}
+
+		corpus[ecosystem] = names
+	}
+
+	return &typosquatScorer{corpus: corpus}, nil
+}
+
+// Best match of a package name against the popular names of its
+// ecosystem, nil when it looks like none of them. A popular name does not
+// squat itself
+func (s *typosquatScorer) score(ecosystem, name string) *typosquatMatch {
+	var best *typosquatMatch
+	for _, target := range s.corpus[ecosystem] {
+		technique, score := typosquatTechnique(ecosystem, name, target)
+		if (technique != "") && ((best == nil) || (score > best.Score)) {
+			best = &typosquatMatch{Target: target, Technique: technique, Score: score}
+		}
+	}
+
+	return best
+}
+
+// Technique of a name squatting a popular name and its score, empty when
+// it does not look like one
+func typosquatTechnique(ecosystem, name, target string) (string, float64) {
+	lowerName, lowerTarget := strings.ToLower(name), strings.ToLower(target)
+	if lowerName == lowerTarget {
+		return "", 0
+	}
+
+	// PyPI treats runs of separators alike, the names are the same package
+	if (ecosystem == pypiEcosystem) && (normalizePyPIName(lowerName) == normalizePyPIName(lowerTarget)) {
+		return "", 0
+	}
+
+	if stripSeparators(lowerName) == stripSeparators(lowerTarget) {
+		return typosquatSeparator, typosquatScores[typosquatSeparator]
+	}
+
+	if foldHomoglyphs(lowerName) == foldHomoglyphs(lowerTarget) {
+		return typosquatHomoglyph, typosquatScores[typosquatHomoglyph]
+	}
+
+	if (ecosystem == npmEcosystem) && isScopeConfusion(lowerName, lowerTarget) {
+		return typosquatScope, typosquatScores[typosquatScope]
+	}
+
+	if len([]rune(lowerTarget)) < typosquatMinLength {
+		return "", 0
+	}
+
+	switch distance := editDistance(lowerName, lowerTarget); {
+	case (distance == 1) && isKeyboardTypo(lowerName, lowerTarget):
+		return typosquatKeyboard, typosquatScores[typosquatKeyboard]
+	case distance == 1:
+		return typosquatEdit, typosquatScores[typosquatEdit]
+	case (distance == 2) && (len([]rune(lowerTarget)) >= typosquatFarEditLength):
+		return typosquatEdit, typosquatFarEditScore
+	}
+
+	return "", 0
+}
+
+// Name without the separators registries treat as distinct characters
+func stripSeparators(name string) string {
+	return strings.NewReplacer("-", "", "_", "", ".", "").Replace(name)
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// Name of a PyPI package as normalized by PEP 503
+func normalizePyPIName(name string) string {
+	return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// Sequences rendered alike in most fonts, folded to the letters they
+// imitate. Sequences of several runes are listed, and so tried, first
+var homoglyphReplacer = strings.NewReplacer(
+	"rn", "m", "vv", "w", "cl", "d",
+	"0", "o", "1", "l", "i", "l", "|", "l", "5", "s",
+	// Cyrillic
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "х", "x", "у", "y", "і", "l", "ј", "j", "ѕ", "s",
+	"ԁ", "d", "ɡ", "g",
+	// Greek
+	"ο", "o", "α", "a", "ν", "v", "ι", "l",
+)
+
+func foldHomoglyphs(name string) string {
+	return homoglyphReplacer.Replace(name)
+}
+
+// Check whether an npm name confuses the scope of a popular name: the name
+// of an unscoped package under a scope, a scoped name without the scope,
+// or the name of a scoped package under another scope
+func isScopeConfusion(name, target string) bool {
+	nameScope, nameBare := splitScope(name)
+	targetScope, targetBare := splitScope(target)
+
+	switch {
+	case (targetScope == "") && (nameScope != ""):
+		return nameBare == targetBare
+	case (targetScope != "") && (nameScope == ""):
+		return stripSeparators(nameBare) == stripSeparators(strings.TrimPrefix(targetScope, "@")+targetBare)
+	case (targetScope != "") && (nameScope != ""):
+		return (nameBare == targetBare) && (editDistance(nameScope, targetScope) <= 2)
+	}
+
+	return false
+}
+
+// Split the @scope of an npm name, empty when unscoped
+func splitScope(name string) (string, string) {
+	if scope, bare, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+		return scope, bare
+	}
+
+	return "", name
+}
+
+// Rows of a QWERTY keyboard, each shifted right of the one above
+var keyboardRows = []string{"1234567890-", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// Keys next to each key, on its row and the rows above and below
+var keyboardNeighbors = func() map[rune]string {
+	neighbors := make(map[rune]string)
+	at := func(row, col int) string {
+		if (row < 0) || (row >= len(keyboardRows)) || (col < 0) || (col >= len(keyboardRows[row])) {
+			return ""
+		}
+
+		return keyboardRows[row][col : col+1]
+	}
+
+	for row, keys := range keyboardRows {
+		for col, key := range keys {
+			neighbors[key] = at(row, col-1) + at(row, col+1) +
+				at(row-1, col) + at(row-1, col+1) + at(row+1, col-1) + at(row+1, col)
+		}
+	}
+
+	return neighbors
+}()
+
+// Check whether two names of the same length differ by one key replaced
+// by a neighbor
+func isKeyboardTypo(name, target string) bool {
+	rn, rt := []rune(name), []rune(target)
+	if len(rn) != len(rt) {
+		return false
+	}
+
+	for i := range rn {
+		if rn[i] != rt[i] {
+			return strings.ContainsRune(keyboardNeighbors[rt[i]], rn[i]) && (string(rn[i+1:]) == string(rt[i+1:]))
+		}
+	}
+
+	return false
+}
+
+// Edit distance between two strings, in runes. The optimal string
+// alignment distance, the swap of adjacent runes counts as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if (i > 1) && (j > 1) && (ra[i-1] == rb[j-2]) && (ra[i-2] == rb[j-1]) {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
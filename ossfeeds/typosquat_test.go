@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTyposquatScore(t *testing.T) {
+	scorer, err := newTyposquatScorer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ecosystem string
+		name      string
+		target    string
+		technique string
+	}{
+		// Popular packages do not squat themselves
+		{npmEcosystem, "express", "", ""},
+		{npmEcosystem, "Lodash", "", ""},
+		{npmEcosystem, "react_dom", "react-dom", typosquatSeparator},
+		{npmEcosystem, "reactdom", "react-dom", typosquatSeparator},
+		// PyPI normalizes separators, it is the same package
+		{pypiEcosystem, "python_dateutil", "", ""},
+		{pypiEcosystem, "Python.-Dateutil", "", ""},
+		{pypiEcosystem, "pythondateutil", "python-dateutil", typosquatSeparator},
+		{npmEcosystem, "1odash", "lodash", typosquatHomoglyph},
+		{npmEcosystem, "expresѕ", "express", typosquatHomoglyph},
+		{pypiEcosystem, "rnatplotlib", "matplotlib", typosquatHomoglyph},
+		{npmEcosystem, "@fake/lodash", "lodash", typosquatScope},
+		{npmEcosystem, "babel-core", "@babel/core", typosquatScope},
+		{npmEcosystem, "@babe1/core", "@babel/core", typosquatHomoglyph},
+		{npmEcosystem, "@bable/core", "@babel/core", typosquatScope},
+		{npmEcosystem, "@types/nodes", "@types/node", typosquatEdit},
+		{npmEcosystem, "exprwss", "express", typosquatKeyboard},
+		{npmEcosystem, "axois", "axios", typosquatEdit},
+		{npmEcosystem, "expres", "express", typosquatEdit},
+		{cratesEcosystem, "serde-json", "serde_json", typosquatSeparator},
+		{pypiEcosystem, "cryptograhpyy", "cryptography", typosquatEdit},
+		// Short names are not compared by edit distance
+		{npmEcosystem, "vuw", "", ""},
+		{npmEcosystem, "left-pad", "", ""},
+	}
+
+	for _, test := range cases {
+		match := scorer.score(test.ecosystem, test.name)
+		if test.target == "" {
+			if match != nil {
+				t.Errorf("%s: expected no match, got %+v", test.name, match)
+			}
+
+			continue
+		}
+
+		if match == nil {
+			t.Errorf("%s: expected a match of %s", test.name, test.target)
+			continue
+		}
+
+		if (match.Target != test.target) || (match.Technique != test.technique) {
+			t.Errorf("%s: expected %s by %s, got %s by %s", test.name, test.target, test.technique,
+				match.Target, match.Technique)
+		}
+	}
+}
+
+func TestTyposquatScoreOrder(t *testing.T) {
+	scorer, err := newTyposquatScorer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	near := scorer.score(pypiEcosystem, "cryptograpy")
+	far := scorer.score(pypiEcosystem, "cryptograhpyy")
+
+	if (near == nil) || (far == nil) || (near.Score <= far.Score) {
+		t.Errorf("expected one edit to score higher than two, got %+v and %+v", near, far)
+	}
+}
+
+func TestTyposquatCorpus(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "corpus.json")
+	if err := os.WriteFile(file, []byte(`{"npm": ["internal-utils"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scorer, err := newTyposquatScorer(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match := scorer.score(npmEcosystem, "internal_utils"); (match == nil) || (match.Target != "internal-utils") {
+		t.Errorf("expected a match of the configured corpus, got %+v", match)
+	}
+
+	if match := scorer.score(npmEcosystem, "1odash"); match != nil {
+		t.Errorf("expected the default npm corpus replaced, got %+v", match)
+	}
+
+	if match := scorer.score(pypiEcosystem, "reqeusts"); match == nil {
+		t.Errorf("expected the default corpus of other ecosystems kept")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"lodash", "lodash", 0},
+		{"lodash", "1odash", 1},
+		{"express", "expresss", 1},
+		{"axios", "axois", 1},
+		{"react", "raect", 1},
+		{"express", "expres", 1},
+		{"", "abc", 3},
+		{"ca", "abc", 3},
+		{"crème", "creme", 1},
+	}
+
+	for _, test := range cases {
+		if actual := editDistance(test.a, test.b); actual != test.expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.a, test.b, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A package version waiting to be submitted for analysis
+type submission struct {
+	ecosystem string
+	pkg       *feeds.Package
+	key       string
+
+	// Popular package the package likely squats, nil when none
+	typosquat *typosquatMatch
+
+	// Batch the package version was queued with, nil when none
+	batch *submissionBatch
+}
+
+// Package versions queued by one poll of a feed. The cutoff of the poll is
+// checkpointed once the batch is done, a version still queued or failed
+// must be polled again after a restart
+type submissionBatch struct {
+	wg     sync.WaitGroup
+	failed atomic.Int64
+}
+
+// Only transient failures fail the batch. A version rejected by the
+// service would be rejected again on every poll
+func (b *submissionBatch) done(err error) {
+	if (err != nil) && isTransient(err) {
+		b.failed.Add(1)
+	}
+
+	b.wg.Done()
+}
+
+// Wait for the submissions of the batch, returning whether all succeeded
+func (b *submissionBatch) wait() bool {
+	b.wg.Wait()
+	return b.failed.Load() == 0
+}
+
+// Counters of the submission pool
+type poolStats struct {
+	queued    atomic.Int64
+	inFlight  atomic.Int64
+	submitted atomic.Int64
+	failed    atomic.Int64
+	rejected  atomic.Int64
+	retried   atomic.Int64
+}
+
+// Bounded pool of workers submitting packages for analysis. Feeds enqueue
+// their packages and block while the queue is full, so a slow service
+// slows down polling instead of growing memory. Likely typosquats go to a
+// priority queue served first. Every call has a deadline, calls failing
+// with a transient code are retried with a backoff, other failures reject
+// the package version
+type submissionPool struct {
+	queue    chan submission
+	priority chan submission
+
+	// Typosquat score from which submissions are prioritized
+	priorityScore float64
+
+	timeout time.Duration
+	retries int
+	backoff backoff
+
+	// Submit a package version, returning the id of the analysis
+	submit func(ctx context.Context, s submission) (string, error)
+
+	// Called once a package version is submitted
+	submitted func(s submission, analysisID string)
+
+	// Called when the service rejects a package version with a permanent
+	// error, it is not worth submitting again
+	rejected func(s submission)
+
+	m      sync.Mutex
+	queued map[string]bool
+
+	stats   poolStats
+	metrics *pollerMetrics
+}
+
+func newSubmissionPool(size int, priorityScore float64, timeout time.Duration, retries int, retryBackoff backoff,
+	submit func(context.Context, submission) (string, error),
+	submitted func(submission, string), rejected func(submission), m *pollerMetrics) *submissionPool {
+	return &submissionPool{
+		queue:         make(chan submission, size),
+		priority:      make(chan submission, size),
+		priorityScore: priorityScore,
+		timeout:       timeout,
+		retries:       retries,
+		backoff:       retryBackoff,
+		submit:        submit,
+		submitted:     submitted,
+		rejected:      rejected,
+		queued:        make(map[string]bool),
+		metrics:       m,
+	}
+}
+
+// Start the workers, the priority queue is drained before the queue
+func (p *submissionPool) start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case s := <-p.priority:
+					p.process(s)
+					continue
+				default:
+				}
+
+				select {
+				case s := <-p.priority:
+					p.process(s)
+				case s := <-p.queue:
+					p.process(s)
+				}
+			}
+		}()
+	}
+}
+
+// Queue a package version, waiting while the queue is full. A version
+// already queued is not queued again
+func (p *submissionPool) enqueue(s submission) bool {
+	p.m.Lock()
+	if p.queued[s.key] {
+		p.m.Unlock()
+		return false
+	}
+
+	p.queued[s.key] = true
+	p.m.Unlock()
+
+	if s.batch != nil {
+		s.batch.wg.Add(1)
+	}
+
+	p.stats.queued.Add(1)
+	if (s.typosquat != nil) && (s.typosquat.Score >= p.priorityScore) {
+		p.priority <- s
+	} else {
+		p.queue <- s
+	}
+
+	return true
+}
+
+// Submissions waiting in the queues
+func (p *submissionPool) depth() int {
+	return len(p.queue) + len(p.priority)
+}
+
+func (p *submissionPool) process(s submission) {
+	p.stats.inFlight.Add(1)
+	defer p.stats.inFlight.Add(-1)
+
+	analysisID, err := p.submitWithRetries(s)
+	switch {
+	case err == nil:
+		p.submitted(s, analysisID)
+		p.stats.submitted.Add(1)
+		p.metrics.submissions.WithLabelValues(s.ecosystem).Inc()
+	case isTransient(err):
+		p.stats.failed.Add(1)
+		p.metrics.submissionFailures.WithLabelValues(status.Code(err).String()).Inc()
+		fmt.Printf("Error submitting package for analysis: %v\n", err)
+	default:
+		p.rejected(s)
+		p.stats.rejected.Add(1)
+		p.metrics.submissionsRejected.WithLabelValues(s.ecosystem).Inc()
+		fmt.Printf("Package %s rejected for analysis, not submitting it again: %v\n", s.key, err)
+	}
+
+	// The version can be queued again once its batch is done
+	p.m.Lock()
+	delete(p.queued, s.key)
+	p.m.Unlock()
+
+	if s.batch != nil {
+		s.batch.done(err)
+	}
+}
+
+// Submit with a deadline per call, retrying transient failures
+func (p *submissionPool) submitWithRetries(s submission) (string, error) {
+	retry := p.backoff
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		analysisID, err := p.submit(ctx, s)
+		cancel()
+
+		if (err == nil) || !isTransient(err) || (attempt >= p.retries) {
+			return analysisID, err
+		}
+
+		delay := retry.next()
+		fmt.Printf("Retrying submission of %s in %s: %v\n", s.key, delay.Round(time.Millisecond), err)
+
+		p.stats.retried.Add(1)
+		time.Sleep(delay)
+	}
+}
+
+// Failures of the service worth retrying
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Print the depth of the queue and the counters every interval
+func (p *submissionPool) reportStats(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		fmt.Printf("Submission queue: depth %d/%d in flight %d queued %d submitted %d failed %d rejected %d retried %d\n",
+			p.depth(), cap(p.queue)+cap(p.priority), p.stats.inFlight.Load(), p.stats.queued.Load(),
+			p.stats.submitted.Load(), p.stats.failed.Load(), p.stats.rejected.Load(), p.stats.retried.Load())
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubmissionRetries(t *testing.T) {
+	cases := []struct {
+		name      string
+		errs      []error
+		retries   int
+		submitted bool
+		calls     int
+	}{
+		{"success", nil, 3, true, 1},
+		{"unavailable then success", []error{status.Error(codes.Unavailable, "down")}, 3, true, 2},
+		{"resource exhausted until out of retries", []error{
+			status.Error(codes.ResourceExhausted, "quota"),
+			status.Error(codes.ResourceExhausted, "quota"),
+			status.Error(codes.ResourceExhausted, "quota"),
+		}, 2, false, 3},
+		{"invalid argument is not retried", []error{status.Error(codes.InvalidArgument, "bad")}, 3, false, 1},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			submitted := make(chan string, 1)
+
+			pool := newSubmissionPool(1, 0.7, time.Second, test.retries, backoff{},
+				func(ctx context.Context, s submission) (string, error) {
+					if _, ok := ctx.Deadline(); !ok {
+						t.Errorf("submission without deadline")
+					}
+
+					calls++
+					if calls <= len(test.errs) {
+						return "", test.errs[calls-1]
+					}
+
+					return "analysis", nil
+				},
+				func(s submission, analysisID string) {
+					submitted <- analysisID
+				}, func(submission) {}, newPollerMetrics())
+
+			pool.process(submission{ecosystem: npmEcosystem, key: "npm/left-pad@1.0.0"})
+
+			if calls != test.calls {
+				t.Errorf("expected %d calls, got %d", test.calls, calls)
+			}
+
+			if ok := len(submitted) > 0; ok != test.submitted {
+				t.Errorf("expected submitted %v, got %v", test.submitted, ok)
+			}
+
+			if !test.submitted && (pool.stats.failed.Load()+pool.stats.rejected.Load() != 1) {
+				t.Errorf("expected the failure counted")
+			}
+		})
+	}
+}
+
+func TestSubmissionQueue(t *testing.T) {
+	release := make(chan struct{})
+
+	var m sync.Mutex
+	keys := make([]string, 0)
+
+	pool := newSubmissionPool(4, 0.7, time.Second, 0, backoff{},
+		func(context.Context, submission) (string, error) {
+			<-release
+			return "analysis", nil
+		},
+		func(s submission, _ string) {
+			m.Lock()
+			keys = append(keys, s.key)
+			m.Unlock()
+		}, func(submission) {}, newPollerMetrics())
+
+	batch := &submissionBatch{}
+
+	pkg := &feeds.Package{Name: "left-pad", Version: "1.0.0"}
+	for _, key := range []string{"npm/left-pad@1.0.0", "npm/left-pad@1.0.0", "npm/left-pad@1.0.1"} {
+		pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: key, batch: batch})
+	}
+
+	if depth := pool.depth(); depth != 2 {
+		t.Errorf("expected the duplicate dropped and 2 queued, got %d", depth)
+	}
+
+	pool.start(2)
+	close(release)
+
+	if !batch.wait() {
+		t.Fatalf("expected the batch submitted")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(keys) != 2 {
+		t.Errorf("expected 2 submissions, got %v", keys)
+	}
+}
+
+func TestSubmissionBatchFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		ok       bool
+		rejected bool
+	}{
+		{"transient failure out of retries", status.Error(codes.Unavailable, "down"), false, false},
+		{"permanent failure", status.Error(codes.InvalidArgument, "bad"), true, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			rejected := make(chan string, 1)
+			metrics := newPollerMetrics()
+
+			pool := newSubmissionPool(4, 0.7, time.Second, 0, backoff{},
+				func(_ context.Context, s submission) (string, error) {
+					if s.key == "npm/left-pad@1.0.1" {
+						return "", test.err
+					}
+
+					return "analysis", nil
+				},
+				func(submission, string) {},
+				func(s submission) {
+					rejected <- s.key
+				}, metrics)
+
+			batch := &submissionBatch{}
+
+			pkg := &feeds.Package{Name: "left-pad", Version: "1.0.0"}
+			for _, key := range []string{"npm/left-pad@1.0.0", "npm/left-pad@1.0.1"} {
+				pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: key, batch: batch})
+			}
+
+			pool.start(2)
+
+			// Only a transient failure fails the batch, a rejected version
+			// would be rejected again on every poll
+			if ok := batch.wait(); ok != test.ok {
+				t.Errorf("expected the batch to succeed %v, got %v", test.ok, ok)
+			}
+
+			if ok := len(rejected) > 0; ok != test.rejected {
+				t.Errorf("expected the version rejected %v, got %v", test.rejected, ok)
+			}
+
+			families, err := metrics.registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A vector of counters gathers the labels counted only
+			counted := false
+			for _, family := range families {
+				counted = counted || (family.GetName() == "ossfeeds_submissions_rejected_total")
+			}
+
+			if counted != test.rejected {
+				t.Errorf("expected the rejection counted %v, got %v", test.rejected, counted)
+			}
+
+			// The failed version can be queued again by the next poll
+			if !pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: "npm/left-pad@1.0.1"}) {
+				t.Errorf("expected the failed version queued again")
+			}
+		})
+	}
+}
+
+func TestSubmissionPriority(t *testing.T) {
+	order := make(chan string, 3)
+
+	pool := newSubmissionPool(4, 0.7, time.Second, 0, backoff{},
+		func(context.Context, submission) (string, error) {
+			return "analysis", nil
+		},
+		func(s submission, _ string) {
+			order <- s.key
+		}, func(submission) {}, newPollerMetrics())
+
+	pkg := &feeds.Package{Name: "lodash", Version: "1.0.0"}
+	pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: "npm/lodash@1.0.0"})
+	pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: "npm/lodahs@1.0.0",
+		typosquat: &typosquatMatch{Target: "lodash", Technique: typosquatEdit, Score: 0.5}})
+	pool.enqueue(submission{ecosystem: npmEcosystem, pkg: pkg, key: "npm/1odash@1.0.0",
+		typosquat: &typosquatMatch{Target: "lodash", Technique: typosquatHomoglyph, Score: 0.9}})
+
+	pool.start(1)
+
+	expected := []string{"npm/1odash@1.0.0", "npm/lodash@1.0.0", "npm/lodahs@1.0.0"}
+	for _, key := range expected {
+		select {
+		case actual := <-order:
+			if actual != key {
+				t.Errorf("expected %s, got %s", key, actual)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("submissions did not complete")
+		}
+	}
+}
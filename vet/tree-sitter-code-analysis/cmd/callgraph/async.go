@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// How an event loop function uses its arguments
+type eventLoopFunction struct {
+	// Position of the callable it calls, -1 when the arguments are
+	// coroutines or awaitables instead
+	callback int
+
+	// The result is the value of the coroutines or of the callable
+	returnsValue bool
+}
+
+// Functions of asyncio, matched by their dotted name
+var eventLoopFunctions = map[string]eventLoopFunction{
+	"asyncio.run":           {callback: -1, returnsValue: true},
+	"asyncio.create_task":   {callback: -1, returnsValue: true},
+	"asyncio.ensure_future": {callback: -1, returnsValue: true},
+	"asyncio.gather":        {callback: -1, returnsValue: true},
+	"asyncio.wait_for":      {callback: -1, returnsValue: true},
+	"asyncio.shield":        {callback: -1, returnsValue: true},
+	"asyncio.to_thread":     {callback: 0, returnsValue: true},
+}
+
+// Calls returning the receivers of the event loop methods, an event loop
+// or a task group
+var eventLoopFactories = map[string]bool{
+	"asyncio.get_event_loop":   true,
+	"asyncio.get_running_loop": true,
+	"asyncio.new_event_loop":   true,
+	"asyncio.TaskGroup":        true,
+}
+
+// Methods of event loops, matched by the last attribute once the receiver
+// is known to hold the value of an event loop factory, the loop is usually
+// a variable, as in loop = asyncio.get_event_loop()
+var eventLoopMethods = map[string]eventLoopFunction{
+	"run_until_complete":   {callback: -1, returnsValue: true},
+	"create_task":          {callback: -1, returnsValue: true},
+	"ensure_future":        {callback: -1, returnsValue: true},
+	"run_in_executor":      {callback: 1, returnsValue: true},
+	"call_soon":            {callback: 0},
+	"call_soon_threadsafe": {callback: 0},
+	"call_later":           {callback: 1},
+	"call_at":              {callback: 1},
+}
+
+// Model event loop entry points. Coroutines passed to them are already
+// called where they are created, their value flows into the result.
+// Callables scheduled on the loop get a call edge from the scheduling
+// namespace. Returns false when the callee is not an event loop function
+func (b *AssignmentGraphBuilder) visitEventLoopCall(v *Visitor, node *sitter.Node,
+	calleeName string) (*definition, bool, error) {
+	function, ok := eventLoopFunctions[calleeName]
+	if !ok {
+		attributes := strings.Split(calleeName, ".")
+		if len(attributes) < 2 {
+			return nil, false, nil
+		}
+
+		if function, ok = eventLoopMethods[attributes[len(attributes)-1]]; !ok {
+			return nil, false, nil
+		}
+
+		if !b.isEventLoopReceiver(node, strings.Join(attributes[:len(attributes)-1], ".")) {
+			return nil, false, nil
+		}
+	}
+
+	b.callEdge(calleeName)
+
+	args, err := b.evalArguments(v, node)
+	if err != nil {
+		return nil, true, err
+	}
+
+	retDef := b.newDefinition(idTypeUnknown, fmt.Sprintf("__call_%s", calleeName))
+
+	if function.callback < 0 {
+		for _, arg := range args {
+			if function.returnsValue && (arg.position >= 0) {
+				b.assignmentEdge(retDef, b.definitionsRegistry[arg.def])
+			}
+		}
+
+		return retDef, true, nil
+	}
+
+	// The callable is found by name, callables held in variables are not
+	// resolved
+	argNodes := callArguments(node)
+	if (function.callback >= len(args)) || (args[function.callback].position != function.callback) {
+		return retDef, true, nil
+	}
+
+	callableName, err := b.resolveName(v, argNodes[function.callback])
+	if err != nil {
+		return nil, true, err
+	}
+
+	calleeDef, ok := b.findAttributedNameInScope(callableName)
+	if !ok || (calleeDef.idType != idTypeFunction) {
+		return retDef, true, nil
+	}
+
+	tracef("Scheduled callee: %s\n", calleeDef.id())
+	b.callEdge(calleeDef.id())
+
+	// Remaining positional arguments are passed to the callable
+	callableArgs := make([]callArgument, 0)
+	for _, arg := range args {
+		if arg.position > function.callback {
+			arg.position -= function.callback + 1
+			callableArgs = append(callableArgs, arg)
+		}
+	}
+
+	site := b.newCallSite(node, calleeDef, callableArgs)
+	if function.returnsValue && (b.contextDepth > 0) {
+		site.ret = retDef.id()
+	}
+
+	b.recordCallSite(site)
+
+	if function.returnsValue && (b.contextDepth == 0) {
+		if ret, ok := b.returnDefinition(calleeDef.id()); ok {
+			b.assignmentEdge(retDef, ret)
+		}
+	}
+
+	return retDef, true, nil
+}
+
+// Check whether the receiver of a method call holds an event loop or a
+// task group, the value of a call to a factory reached through assignments.
+// The receiver is either a call, as in asyncio.get_event_loop().call_soon,
+// or a name
+func (b *AssignmentGraphBuilder) isEventLoopReceiver(node *sitter.Node, receiverName string) bool {
+	var receiver *definition
+
+	function := node.ChildByFieldName("function")
+	if object := function.ChildByFieldName("object"); (function.Type() == "attribute") && (object != nil) {
+		receiver = b.callReceivers[callSiteId(object)]
+	}
+
+	if receiver == nil {
+		def, ok := b.findAttributedNameInScope(receiverName)
+		if !ok {
+			return false
+		}
+
+		receiver = def
+	}
+
+	found := false
+	depthFirst([]string{receiver.id()}, func(id string) []string {
+		return b.assignmentGraph[id]
+	}, func(id string) bool {
+		if def, ok := b.definitionsRegistry[id]; ok && (def.idType == idTypeUnknown) {
+			found = found || eventLoopFactories[strings.TrimPrefix(def.name, "__call_")]
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// The value of await is the value of the awaitable, calls to coroutine
+// functions already evaluate to their return node
+func (b *AssignmentGraphBuilder) visitAwait(v *Visitor, node *sitter.Node) (*definition, error) {
+	if node.NamedChildCount() < 1 {
+		return nil, fmt.Errorf("Invalid await")
+	}
+
+	return b.eval(v, node.NamedChild(0))
+}
+
+// Targets of with items, including async with, are bound to the context
+// manager. Values returned by __enter__ and __aenter__ are not tracked
+func (b *AssignmentGraphBuilder) visitWithStatement(v *Visitor, node *sitter.Node) (*definition, error) {
+	body := node.ChildByFieldName("body")
+	if body == nil {
+		return nil, fmt.Errorf("Invalid with statement")
+	}
+
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		clause := node.NamedChild(i)
+		if clause.Type() != "with_clause" {
+			continue
+		}
+
+		for j := 0; j < int(clause.NamedChildCount()); j++ {
+			value := clause.NamedChild(j).ChildByFieldName("value")
+			if value == nil {
+				continue
+			}
+
+			if value.Type() != "as_pattern" {
+				if _, err := b.eval(v, value); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			alias := value.ChildByFieldName("alias")
+			if (value.NamedChildCount() < 1) || (alias == nil) {
+				return nil, fmt.Errorf("Invalid with item")
+			}
+
+			valueDef, err := b.eval(v, value.NamedChild(0))
+			if err != nil {
+				return nil, err
+			}
+
+			for k := 0; k < int(alias.NamedChildCount()); k++ {
+				targetDef, err := b.eval(v, alias.NamedChild(k))
+				if err != nil {
+					return nil, err
+				}
+
+				b.assignmentEdge(targetDef, valueDef)
+			}
+		}
+	}
+
+	return v.visit(body)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// An argument passed at a call site
+type callArgument struct {
+	// Keyword of the argument, empty when positional
+	keyword string
+
+	// Position among positional arguments, -1 for keywords and splats
+	position int
+
+	// Definition id of the argument value
+	def string
+}
+
+// A call to a function defined in the analyzed module. Without contexts
+// the arguments are bound to the parameters right away, otherwise the
+// binding happens per context once all call sites are known
+type callSite struct {
+	// Position of the call in the source, such as L12:5
+	id string
+
+	// Definition id of the calling namespace
+	caller string
+
+	// Definition id of the callee
+	callee string
+
+	args []callArgument
+
+	// Number of leading parameters bound implicitly, such as self
+	offset int
+
+	// Definition id holding the return value, empty when unused
+	ret string
+}
+
+func callSiteId(node *sitter.Node) string {
+	return fmt.Sprintf("L%d:%d", node.StartPoint().Row+1, node.StartPoint().Column+1)
+}
+
+// Name bound by a parameter node, ok is false for the bare * and /
+// separators which bind nothing
+func (v *Visitor) parameterName(node *sitter.Node) (string, bool) {
+	switch node.Type() {
+	case "identifier":
+		return v.val(node), true
+	case "default_parameter", "typed_default_parameter":
+		if name := node.ChildByFieldName("name"); name != nil {
+			return v.parameterName(name)
+		}
+	case "typed_parameter", "list_splat_pattern", "dictionary_splat_pattern":
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			if name, ok := v.parameterName(node.NamedChild(i)); ok {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Evaluate the arguments of a call, keeping their keyword or position
+// for binding to parameters
+func (b *AssignmentGraphBuilder) evalArguments(v *Visitor, node *sitter.Node) ([]callArgument, error) {
+	args := make([]callArgument, 0)
+
+	position := 0
+	for _, arg := range callArguments(node) {
+		callArg := callArgument{position: -1}
+		value := arg
+
+		switch arg.Type() {
+		case "keyword_argument":
+			name := arg.ChildByFieldName("name")
+			value = arg.ChildByFieldName("value")
+			if (name == nil) || (value == nil) {
+				return nil, fmt.Errorf("Invalid keyword argument")
+			}
+
+			callArg.keyword = v.val(name)
+		case "list_splat", "dictionary_splat":
+		default:
+			callArg.position = position
+			position++
+		}
+
+		argDef, err := b.eval(v, value)
+		if err != nil {
+			return nil, err
+		}
+
+		callArg.def = argDef.id()
+		args = append(args, callArg)
+	}
+
+	return args, nil
+}
+
+func (b *AssignmentGraphBuilder) newCallSite(node *sitter.Node, callee *definition, args []callArgument) *callSite {
+	return &callSite{
+		id:     callSiteId(node),
+		caller: b.currentNamespace.definition.id(),
+		callee: callee.id(),
+		args:   args,
+	}
+}
+
+// Bind the arguments of a call site, or keep it for cloning when the
+// analysis is context sensitive
+func (b *AssignmentGraphBuilder) recordCallSite(site *callSite) {
+	if b.contextDepth > 0 {
+		b.callSites = append(b.callSites, site)
+		return
+	}
+
+	for _, binding := range b.parameterBindings(site) {
+		b.assignmentEdge(b.definitionsRegistry[binding[0]], b.definitionsRegistry[binding[1]])
+	}
+}
+
+// Pairs of parameter and argument definition ids. Positional arguments
+// are matched in order after the implicit parameters, keywords by name
+func (b *AssignmentGraphBuilder) parameterBindings(site *callSite) [][2]string {
+	params := b.parameters[site.callee]
+	bindings := make([][2]string, 0)
+
+	for _, arg := range site.args {
+		switch {
+		case arg.keyword != "":
+			for _, param := range params {
+				if b.definitionsRegistry[param].name == arg.keyword {
+					bindings = append(bindings, [2]string{param, arg.def})
+					break
+				}
+			}
+		case arg.position >= 0:
+			if index := arg.position + site.offset; index < len(params) {
+				bindings = append(bindings, [2]string{params[index], arg.def})
+			}
+		}
+	}
+
+	return bindings
+}
+
+// Clone the definitions of every function per calling context, the last
+// k call sites leading to it, and bind arguments and return values to
+// the clones. Functions not reachable from the module top level, such as
+// mutually recursive ones never called, are cloned from an empty context.
+// Cloning again after new call sites are found only adds edges
+func (b *AssignmentGraphBuilder) cloneContexts() {
+	sitesByCaller := make(map[string][]*callSite)
+	called := make(map[string]bool)
+
+	for _, site := range b.callSites {
+		sitesByCaller[site.caller] = append(sitesByCaller[site.caller], site)
+		called[site.callee] = true
+	}
+
+	// Receiver calls were resolved with shared return values, the clones
+	// replace them
+	for _, site := range b.callSites {
+		if site.ret != "" {
+			if ret, ok := b.returnDefinition(site.callee); ok {
+				b.removeAssignmentEdge(site.ret, ret.id())
+			}
+		}
+	}
+
+	// Edges added while cloning are not cloned again
+	edges := make(map[string][]string, len(b.assignmentGraph))
+	for from, targets := range b.assignmentGraph {
+		edges[from] = append([]string(nil), targets...)
+	}
+
+	type contextCall struct {
+		site    *callSite
+		context []string
+	}
+
+	worklist := make([]contextCall, 0)
+	for _, site := range b.callSites {
+		if !called[site.caller] {
+			worklist = append(worklist, contextCall{site: site})
+		}
+	}
+
+	cloned := make(map[string]bool)
+	reached := make(map[string]bool)
+
+	for !b.limitReached(nil) {
+		if len(worklist) == 0 {
+			for _, site := range b.callSites {
+				if !reached[site.caller] {
+					reached[site.caller] = true
+					worklist = append(worklist, contextCall{site: site})
+				}
+			}
+
+			if len(worklist) == 0 {
+				break
+			}
+		}
+
+		call := worklist[0]
+		worklist = worklist[1:]
+
+		site := call.site
+		reached[site.caller] = true
+
+		context := append(append([]string(nil), call.context...), site.id)
+		if len(context) > b.contextDepth {
+			context = context[len(context)-b.contextDepth:]
+		}
+
+		caller := b.definitionsRegistry[site.caller]
+		callee := b.definitionsRegistry[site.callee]
+
+		calleeClone := b.contextDefinition(callee, callee, context)
+		callerClone := b.contextDefinition(caller, caller, call.context)
+		b.contextCallEdge(callerClone.id(), calleeClone.id())
+
+		if !cloned[calleeClone.id()] {
+			cloned[calleeClone.id()] = true
+			reached[site.callee] = true
+
+			b.cloneFunction(callee, context, edges)
+
+			for _, inner := range sitesByCaller[site.callee] {
+				worklist = append(worklist, contextCall{site: inner, context: context})
+			}
+		}
+
+		for _, binding := range b.parameterBindings(site) {
+			b.assignmentEdge(
+				b.contextDefinition(b.definitionsRegistry[binding[0]], callee, context),
+				b.contextDefinition(b.definitionsRegistry[binding[1]], caller, call.context))
+		}
+
+		if site.ret != "" {
+			if ret, ok := b.returnDefinition(site.callee); ok {
+				b.assignmentEdge(
+					b.contextDefinition(b.definitionsRegistry[site.ret], caller, call.context),
+					b.contextDefinition(ret, callee, context))
+			}
+		}
+	}
+}
+
+// The __ret definition of a function, if it returns a value
+func (b *AssignmentGraphBuilder) returnDefinition(function string) (*definition, bool) {
+	def, ok := b.definitionsRegistry[function]
+	if !ok || (def.scope == nil) {
+		return nil, false
+	}
+
+	return def.scope.lookup("__ret")
+}
+
+// Copy the edges leaving definitions of a function into its clone
+func (b *AssignmentGraphBuilder) cloneFunction(function *definition, context []string, edges map[string][]string) {
+	prefix := strings.TrimSuffix(function.id(), fmt.Sprintf("[%s]", idTypeFunction)) + "/"
+
+	for _, from := range sortedKeys(edges) {
+		if !strings.HasPrefix(from, prefix) {
+			continue
+		}
+
+		fromClone := b.contextDefinition(b.definitionsRegistry[from], function, context)
+		for _, to := range edges[from] {
+			b.assignmentEdge(fromClone, b.contextDefinition(b.definitionsRegistry[to], function, context))
+		}
+	}
+}
+
+// The clone of a definition for a function context. Definitions outside
+// the function are shared by all contexts and returned as is
+func (b *AssignmentGraphBuilder) contextDefinition(def, function *definition, context []string) *definition {
+	if (len(context) == 0) || (def == nil) || (function.idType != idTypeFunction) {
+		return def
+	}
+
+	var clone *definition
+	if def.id() == function.id() {
+		clone = newDefinition(function.ns, idTypeFunction,
+			fmt.Sprintf("%s@%s", function.name, strings.Join(context, ",")))
+	} else {
+		ns, ok := b.contextNamespace(def.ns, function, context)
+		if !ok {
+			return def
+		}
+
+		clone = newDefinition(ns, def.idType, def.name)
+	}
+
+	clone.scope = def.scope
+
+	if existing, ok := b.definitionsRegistry[clone.id()]; ok {
+		return existing
+	}
+
+	b.definitionsRegistry[clone.id()] = clone
+	b.contextClones[def.id()] = append(b.contextClones[def.id()], clone.id())
+
+	return clone
+}
+
+// The namespace chain of a clone, ok is false when the namespace is not
+// nested in the function
+func (b *AssignmentGraphBuilder) contextNamespace(ns *namespace, function *definition,
+	context []string) (*namespace, bool) {
+	if (ns == nil) || (ns.definition == nil) {
+		return nil, false
+	}
+
+	if ns.definition.id() == function.id() {
+		return newNamespace(b.contextDefinition(function, function, context), ns.scope, ns.parent), true
+	}
+
+	parent, ok := b.contextNamespace(ns.parent, function, context)
+	if !ok {
+		return nil, false
+	}
+
+	return newNamespace(newDefinition(parent, ns.definition.idType, ns.definition.name), ns.scope, parent), true
+}
+
+func (b *AssignmentGraphBuilder) contextCallEdge(caller, callee string) {
+	for _, id := range b.contextCallGraph[caller] {
+		if id == callee {
+			return
+		}
+	}
+
+	b.contextCallGraph[caller] = append(b.contextCallGraph[caller], callee)
+}
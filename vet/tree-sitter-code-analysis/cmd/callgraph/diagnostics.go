@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Maximum length of source text quoted in a diagnostic message
+const diagnosticSourceMaxLength = 40
+
+// A problem found while analyzing a file. Real world packages contain
+// Python 2 files and templates, so these do not stop the analysis
+type diagnostic struct {
+	File    string `json:"file"`
+	Line    uint32 `json:"line"`
+	Column  uint32 `json:"column"`
+	Message string `json:"message"`
+}
+
+func (v *Visitor) diagnostic(node *sitter.Node, message string) {
+	// Code strings are reported at the call executing them
+	if v.execCall != nil {
+		node = v.execCall
+		message = "In code string: " + message
+	}
+
+	tracef("Diagnostic: %s:%d:%d: %s\n", v.file,
+		node.StartPoint().Row+1, node.StartPoint().Column+1, message)
+
+	v.builder.diagnostics = append(v.builder.diagnostics, diagnostic{
+		File:    v.file,
+		Line:    node.StartPoint().Row + 1,
+		Column:  node.StartPoint().Column + 1,
+		Message: message,
+	})
+}
+
+// Report ERROR and MISSING nodes produced by tree-sitter error recovery.
+// The visitor skips these subtrees
+func (v *Visitor) collectSyntaxDiagnostics(node *sitter.Node) {
+	if !node.HasError() {
+		return
+	}
+
+	if node.IsMissing() {
+		v.diagnostic(node, fmt.Sprintf("Syntax error: missing %s", node.Type()))
+		return
+	}
+
+	if node.IsError() {
+		source := v.val(node)
+		if len(source) > diagnosticSourceMaxLength {
+			source = source[:diagnosticSourceMaxLength] + "..."
+		}
+
+		v.diagnostic(node, fmt.Sprintf("Syntax error: unexpected %q", source))
+		return
+	}
+
+	for i := 0; i < int(node.ChildCount()); i++ {
+		v.collectSyntaxDiagnostics(node.Child(i))
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+// Kinds of obfuscation indicators reported when a dynamic construct
+// can not be resolved statically
+const (
+	obfuscationDynamicAttribute = "dynamic_attribute"
+	obfuscationDynamicImport    = "dynamic_import"
+	obfuscationDynamicExec      = "dynamic_exec"
+)
+
+// Maximum length of an expression recorded in an obfuscation indicator
+const obfuscationExpressionMaxLength = 120
+
+// Maximum nesting of code strings passed to exec(..) and visited. Code
+// executing itself, as in s = "exec(s)"; exec(s), would otherwise be
+// visited until the stack overflows
+const maxExecDepth = 8
+
+type obfuscationIndicator struct {
+	Kind       string `json:"kind"`
+	Expression string `json:"expression"`
+	Namespace  string `json:"namespace"`
+	Line       uint32 `json:"line"`
+	Column     uint32 `json:"column"`
+}
+
+func (b *AssignmentGraphBuilder) obfuscationIndicator(v *Visitor, node *sitter.Node, kind string) {
+	expression := v.val(node)
+	if len(expression) > obfuscationExpressionMaxLength {
+		expression = expression[:obfuscationExpressionMaxLength] + "..."
+	}
+
+	tracef("Obfuscation indicator: %s: %s\n", kind, expression)
+
+	b.obfuscationIndicators = append(b.obfuscationIndicators, obfuscationIndicator{
+		Kind:       kind,
+		Expression: expression,
+		Namespace:  b.currentNamespace.id(),
+		Line:       node.StartPoint().Row + 1,
+		Column:     node.StartPoint().Column + 1,
+	})
+}
+
+// Create a literal definition holding a folded constant
+func (b *AssignmentGraphBuilder) newConstant(value string) *definition {
+	def := b.newDefinition(idTypeLiteral, strconv.Quote(value))
+	b.constants[def.id()] = value
+
+	return def
+}
+
+// Resolve the constant value of a definition by following the assignment
+// graph. Definitions that may hold different values are not constant
+func (b *AssignmentGraphBuilder) constantValue(def *definition) (string, bool) {
+	return b.uniqueValue(def.id(), func(id string) (string, bool) {
+		value, ok := b.constants[id]
+		return value, ok
+	})
+}
+
+// Resolve the reference (dotted name) held by a definition by following
+// the assignment graph
+func (b *AssignmentGraphBuilder) referenceValue(def *definition) (string, bool) {
+	return b.uniqueValue(def.id(), func(id string) (string, bool) {
+		if def, ok := b.definitionsRegistry[id]; ok && (def.idType == idTypeReference) {
+			return def.name, true
+		}
+
+		return "", false
+	})
+}
+
+// The value shared by every definition reachable from id that has one.
+// Search stops at definitions with a value, dead ends without a value make
+// the result unknown. Cycles add no value of their own
+func (b *AssignmentGraphBuilder) uniqueValue(id string, valueOf func(string) (string, bool)) (string, bool) {
+	var value string
+	found := false
+	unique := true
+
+	depthFirst([]string{id}, func(id string) []string {
+		return b.assignmentGraph[id]
+	}, func(id string) bool {
+		if !unique {
+			return false
+		}
+
+		if v, ok := valueOf(id); ok {
+			unique = !found || (v == value)
+			value = v
+			found = true
+
+			return false
+		}
+
+		if len(b.assignmentGraph[id]) == 0 {
+			unique = false
+		}
+
+		return unique
+	})
+
+	return value, found && unique
+}
+
+// Resolve the dotted name of a callee expression. Identifiers bound to
+// references created by dynamic lookups are replaced by the reference
+func (b *AssignmentGraphBuilder) resolveName(v *Visitor, node *sitter.Node) (string, error) {
+	switch node.Type() {
+	case "identifier":
+		name := v.val(node)
+		if def, ok := b.findInScope(name); ok {
+			if ref, ok := b.referenceValue(def); ok {
+				return ref, nil
+			}
+		}
+
+		return name, nil
+	case "attribute":
+		object := node.ChildByFieldName("object")
+		attribute := node.ChildByFieldName("attribute")
+
+		if (object == nil) || (attribute == nil) {
+			return v.val(node), nil
+		}
+
+		objectName, err := b.resolveName(v, object)
+		if err != nil {
+			return "", err
+		}
+
+		return objectName + "." + v.val(attribute), nil
+	case "call":
+		def, err := b.eval(v, node)
+		if err != nil {
+			return "", err
+		}
+
+		b.callReceivers[callSiteId(node)] = def
+
+		if ref, ok := b.referenceValue(def); ok {
+			return ref, nil
+		}
+	}
+
+	return v.val(node), nil
+}
+
+// Strip the builtins module from a callee name so that
+// getattr(__builtins__, "exec") is handled as exec
+func builtinName(name string) string {
+	name = strings.TrimPrefix(name, "__builtins__.")
+	return strings.TrimPrefix(name, "builtins.")
+}
+
+// Model builtins commonly used to hide behaviour. Returns false when
+// the callee is not a known dynamic construct
+func (b *AssignmentGraphBuilder) visitDynamicCall(v *Visitor, node *sitter.Node,
+	calleeName string) (*definition, bool, error) {
+	args := callArguments(node)
+
+	switch builtinName(calleeName) {
+	case "getattr":
+		if len(args) < 2 {
+			return nil, false, nil
+		}
+
+		objectName, err := b.resolveName(v, args[0])
+		if err != nil {
+			return nil, true, err
+		}
+
+		attrDef, err := b.eval(v, args[1])
+		if err != nil {
+			return nil, true, err
+		}
+
+		attr, ok := b.constantValue(attrDef)
+		if !ok {
+			b.obfuscationIndicator(v, node, obfuscationDynamicAttribute)
+			return b.newDefinition(idTypeUnknown, "__call_getattr"), true, nil
+		}
+
+		return b.newDefinition(idTypeReference, objectName+"."+attr), true, nil
+	case "__import__", "importlib.import_module", "import_module":
+		if len(args) < 1 {
+			return nil, false, nil
+		}
+
+		moduleDef, err := b.eval(v, args[0])
+		if err != nil {
+			return nil, true, err
+		}
+
+		module, ok := b.constantValue(moduleDef)
+		if !ok {
+			b.obfuscationIndicator(v, node, obfuscationDynamicImport)
+			return b.newDefinition(idTypeUnknown, "__call_import"), true, nil
+		}
+
+		// __import__("a.b") returns the top level package
+		if builtinName(calleeName) == "__import__" {
+			module, _, _ = strings.Cut(module, ".")
+		}
+
+		return b.newDefinition(idTypeReference, module), true, nil
+	case "exec", "eval", "compile":
+		if len(args) < 1 {
+			return nil, false, nil
+		}
+
+		codeDef, err := b.eval(v, args[0])
+		if err != nil {
+			return nil, true, err
+		}
+
+		b.externalCall(node, calleeName, []callArgument{{position: 0, def: codeDef.id()}})
+
+		code, ok := b.constantValue(codeDef)
+		if !ok || (v.execDepth >= maxExecDepth) {
+			b.obfuscationIndicator(v, node, obfuscationDynamicExec)
+			return b.newDefinition(idTypeUnknown, "__call_exec"), true, nil
+		}
+
+		// The code is known, analyze it as if it was inlined
+		if err := b.visitCodeString(v, node, code); err != nil {
+			return nil, true, err
+		}
+
+		return b.newDefinition(idTypeUnknown, "__call_exec"), true, nil
+	case "chr":
+		if len(args) != 1 {
+			return nil, false, nil
+		}
+
+		codeDef, err := b.eval(v, args[0])
+		if err != nil {
+			return nil, true, err
+		}
+
+		if value, ok := b.constantValue(codeDef); ok {
+			if code, err := strconv.ParseInt(value, 0, 32); err == nil {
+				return b.newConstant(string(rune(code))), true, nil
+			}
+		}
+
+		return b.newDefinition(idTypeUnknown, "__call_chr"), true, nil
+	}
+
+	// Handle "sep".join([...]) with constant elements
+	if function := node.ChildByFieldName("function"); (function != nil) &&
+		(function.Type() == "attribute") && strings.HasSuffix(calleeName, ".join") && (len(args) == 1) {
+		return b.visitJoin(v, function.ChildByFieldName("object"), args[0])
+	}
+
+	return nil, false, nil
+}
+
+func (b *AssignmentGraphBuilder) visitJoin(v *Visitor, separator, elements *sitter.Node) (*definition, bool, error) {
+	if (separator == nil) || ((elements.Type() != "list") && (elements.Type() != "tuple")) {
+		return nil, false, nil
+	}
+
+	separatorDef, err := b.eval(v, separator)
+	if err != nil {
+		return nil, true, err
+	}
+
+	sep, constant := b.constantValue(separatorDef)
+
+	values := make([]string, 0, elements.NamedChildCount())
+	for i := 0; i < int(elements.NamedChildCount()); i++ {
+		elementDef, err := b.eval(v, elements.NamedChild(i))
+		if err != nil {
+			return nil, true, err
+		}
+
+		value, ok := b.constantValue(elementDef)
+		if !ok {
+			constant = false
+		}
+
+		values = append(values, value)
+	}
+
+	if !constant {
+		return b.newDefinition(idTypeUnknown, "__call_join"), true, nil
+	}
+
+	return b.newConstant(strings.Join(values, sep)), true, nil
+}
+
+// Parse and visit code passed as a string to exec(..) or eval(..)
+// in the current scope. Diagnostics are reported against the file of
+// the calling visitor at the position of the call
+func (b *AssignmentGraphBuilder) visitCodeString(v *Visitor, call *sitter.Node, code string) error {
+	parser := sitter.NewParser()
+	parser.SetLanguage(python.GetLanguage())
+
+	cst, err := parser.ParseCtx(b.ctx, nil, []byte(code))
+	if err != nil {
+		return err
+	}
+
+	if cst.RootNode() == nil {
+		return fmt.Errorf("Error parsing code string: root node is nil")
+	}
+
+	codeVisitor := newVisitor(v.file, []byte(code), b)
+	codeVisitor.execDepth = v.execDepth + 1
+	codeVisitor.execCall = v.execCall
+	if codeVisitor.execCall == nil {
+		codeVisitor.execCall = call
+	}
+
+	codeVisitor.collectSyntaxDiagnostics(cst.RootNode())
+
+	_, err = codeVisitor.visit(cst.RootNode())
+	return err
+}
+
+func (b *AssignmentGraphBuilder) visitBinaryOperator(v *Visitor, node *sitter.Node) (*definition, error) {
+	left := node.ChildByFieldName("left")
+	right := node.ChildByFieldName("right")
+	operator := node.ChildByFieldName("operator")
+
+	if (left == nil) || (right == nil) || (operator == nil) {
+		return nil, fmt.Errorf("Invalid binary operator")
+	}
+
+	leftDef, err := b.eval(v, left)
+	if err != nil {
+		return nil, err
+	}
+
+	rightDef, err := b.eval(v, right)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fold string concatenation of constants
+	if v.val(operator) == "+" {
+		leftValue, leftOk := b.constantValue(leftDef)
+		rightValue, rightOk := b.constantValue(rightDef)
+
+		if leftOk && rightOk {
+			return b.newConstant(leftValue + rightValue), nil
+		}
+	}
+
+	def := b.newDefinition(idTypeUnknown, "binary_operator")
+	b.assignmentEdge(def, leftDef)
+	b.assignmentEdge(def, rightDef)
+
+	return def, nil
+}
+
+// Adjacent string literals such as "sys" "tem"
+func (b *AssignmentGraphBuilder) visitConcatenatedString(v *Visitor, node *sitter.Node) (*definition, error) {
+	var value strings.Builder
+	constant := true
+
+	// Payloads split over several literals are reported once as a whole
+	payloads := len(b.payloads)
+
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		def, err := b.eval(v, node.NamedChild(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := b.constantValue(def); ok {
+			value.WriteString(s)
+		} else {
+			constant = false
+		}
+	}
+
+	if !constant {
+		return b.newDefinition(idTypeLiteral, v.val(node)), nil
+	}
+
+	def := b.newConstant(value.String())
+
+	b.payloads = b.payloads[:payloads]
+	b.payloadLiteral(node, def, value.String())
+
+	return def, nil
+}
+
+// Arguments of a call, skipping the ( , and ) nodes
+func callArguments(node *sitter.Node) []*sitter.Node {
+	args := node.ChildByFieldName("arguments")
+	if (args == nil) || (args.Type() != "argument_list") {
+		return nil
+	}
+
+	nodes := make([]*sitter.Node, 0, args.NamedChildCount())
+	for i := 0; i < int(args.NamedChildCount()); i++ {
+		nodes = append(nodes, args.NamedChild(i))
+	}
+
+	return nodes
+}
+
+// Value of a literal node, if it is a constant
+func (v *Visitor) literalValue(node *sitter.Node) (string, bool) {
+	switch node.Type() {
+	case "integer":
+		return v.val(node), true
+	case "string":
+		return v.stringValue(node)
+	}
+
+	return "", false
+}
+
+func (v *Visitor) stringValue(node *sitter.Node) (string, bool) {
+	var start, end *sitter.Node
+	for i := 0; i < int(node.ChildCount()); i++ {
+		child := node.Child(i)
+
+		switch child.Type() {
+		case "string_start":
+			start = child
+		case "string_end":
+			end = child
+		case "interpolation":
+			// f-strings are not constant
+			return "", false
+		}
+	}
+
+	if (start == nil) || (end == nil) || (start.EndByte() > end.StartByte()) {
+		return "", false
+	}
+
+	prefix := strings.ToLower(v.val(start))
+	content := string(v.data[start.EndByte():end.StartByte()])
+
+	if strings.Contains(prefix, "r") {
+		return content, true
+	}
+
+	return unescapePythonString(content, strings.Contains(prefix, "b")), true
+}
+
+// Interpret backslash escapes of a Python string literal. Unknown
+// escapes are kept as is, matching Python behaviour. Escapes of a bytes
+// literal are bytes, \xff is the byte 0xff and not the rune U+00FF, and
+// \u and \U are not escapes
+func unescapePythonString(s string, bytes bool) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if (s[i] != '\\') || (i+1 >= len(s)) {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch c := s[i]; c {
+		case '\n':
+			// Line continuation
+		case '\\', '\'', '"':
+			out.WriteByte(c)
+		case 'a':
+			out.WriteByte('\a')
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'v':
+			out.WriteByte('\v')
+		case 'x', 'u', 'U':
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			if (i+size < len(s)) && (!bytes || (c == 'x')) {
+				if code, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32); err == nil {
+					writeEscape(&out, code, bytes)
+					i += size
+					continue
+				}
+			}
+
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for (j < len(s)) && (j < i+3) && (s[j] >= '0') && (s[j] <= '7') {
+				j++
+			}
+
+			code, _ := strconv.ParseUint(s[i:j], 8, 32)
+			writeEscape(&out, code, bytes)
+			i = j - 1
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
+
+// Write the value of a numeric escape, a byte in bytes literals
+func writeEscape(out *strings.Builder, code uint64, bytes bool) {
+	if bytes {
+		out.WriteByte(byte(code))
+	} else {
+		out.WriteRune(rune(code))
+	}
+}
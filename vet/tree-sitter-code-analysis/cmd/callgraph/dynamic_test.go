@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExecNesting(t *testing.T) {
+	path := filepath.Join("testdata", "exec.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	// Code executing itself is visited up to the nesting limit
+	indicators := 0
+	for _, indicator := range builder.obfuscationIndicators {
+		if indicator.Kind == obfuscationDynamicExec {
+			indicators++
+		}
+	}
+
+	if indicators != 1 {
+		t.Errorf("expected a single dynamic exec indicator, got %v", builder.obfuscationIndicators)
+	}
+
+	// Other code strings are still visited
+	found := false
+	for _, callee := range builder.callGraph["testdata.exec[module]"] {
+		if callee == "os.system" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("expected a call to os.system, got %v", builder.callGraph)
+	}
+}
+
+func TestCodeStringDiagnostics(t *testing.T) {
+	path := filepath.Join("testdata", "eval.py")
+
+	_, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) == 0 {
+		t.Fatalf("expected a diagnostic for the code string")
+	}
+
+	// Reported at the call, not at positions in the code string
+	for _, d := range diagnostics {
+		if (d.File != path) || (d.Line != 3) || (d.Column != 9) {
+			t.Errorf("expected the diagnostic at %s:3:9, got %s:%d:%d: %s", path, d.File, d.Line, d.Column, d.Message)
+		}
+	}
+}
+
+func TestUnescapePythonString(t *testing.T) {
+	cases := []struct {
+		value    string
+		bytes    bool
+		expected string
+	}{
+		{`plain`, false, "plain"},
+		{`a\nb\\c\'`, false, "a\nb\\c'"},
+		{`\xffé\101`, false, "ÿéA"},
+		{`\q`, false, `\q`},
+		// Escapes of bytes literals are single bytes
+		{`\xff\x00\101\377`, true, "\xff\x00A\xff"},
+		{`é\u0041`, true, `é\u0041`},
+	}
+
+	for _, test := range cases {
+		if actual := unescapePythonString(test.value, test.bytes); actual != test.expected {
+			t.Errorf("unescapePythonString(%q, %v) = %q, expected %q", test.value, test.bytes, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,781 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+// When the code of an entry point executes
+type entryPointPhase string
+
+const (
+	// While pip installs or builds the package
+	entryPointInstall entryPointPhase = "install"
+
+	// When the package is imported, run as a module or its scripts are used
+	entryPointRun entryPointPhase = "run"
+)
+
+// Kinds of entry points
+const (
+	// Top level of setup.py
+	entryPointSetupScript = "setup_script"
+
+	// setuptools command class overriding a command such as install
+	entryPointCommandClass = "cmdclass"
+
+	// PEP 517 build backend of pyproject.toml
+	entryPointBuildBackend = "build_backend"
+
+	entryPointConsoleScript = "console_script"
+	entryPointGuiScript     = "gui_script"
+
+	// Entry points of other groups, loaded by plugin systems
+	entryPointPlugin = "entry_point"
+
+	// Scripts copied to bin by the scripts argument of setup()
+	entryPointScript = "script"
+
+	// if __name__ == "__main__" block
+	entryPointMain = "main"
+
+	// __main__.py of a package, run by python -m
+	entryPointMainModule = "main_module"
+
+	// Statement of __init__.py calling code when the package is imported
+	entryPointImportTime = "import_time"
+
+	// Import line of a .pth file, run at every interpreter startup
+	entryPointPth = "pth"
+)
+
+// Code of a package executed without being called by other code of the
+// package. Reachability is computed from these
+type entryPoint struct {
+	Kind  string          `json:"kind"`
+	Phase entryPointPhase `json:"phase"`
+
+	// Entry point group, such as console_scripts
+	Group string `json:"group,omitempty"`
+
+	// Script, command or package name
+	Name string `json:"name,omitempty"`
+
+	// Object reference such as pkg.cli:main, a module or the executed
+	// source for import time code
+	Target string `json:"target"`
+
+	// Where the entry point is declared
+	File string `json:"file"`
+	Line uint32 `json:"line"`
+
+	// Definition id of the target, when found in the package
+	Definition string `json:"definition,omitempty"`
+}
+
+type entryPointDiscovery struct {
+	root   string
+	limits analysisLimits
+
+	entryPoints []entryPoint
+	diagnostics []diagnostic
+
+	// Directories of in-tree build backends, relative to the root
+	backendPaths []string
+
+	// Analyses of the modules entry points refer to, by path
+	modules map[string]*AssignmentGraphBuilder
+}
+
+// Directories never holding package code
+func skipDirectory(name string) bool {
+	return strings.HasPrefix(name, ".") || (name == "__pycache__") || (name == "node_modules")
+}
+
+func newEntryPointDiscovery(root string, limits analysisLimits) *entryPointDiscovery {
+	return &entryPointDiscovery{
+		root:        root,
+		limits:      limits,
+		entryPoints: make([]entryPoint, 0),
+		diagnostics: make([]diagnostic, 0),
+		modules:     make(map[string]*AssignmentGraphBuilder),
+	}
+}
+
+// Discover the entry points of a package source tree, such as an
+// extracted sdist
+func discoverEntryPoints(root string, limits analysisLimits) ([]entryPoint, []diagnostic, error) {
+	d := newEntryPointDiscovery(root, limits)
+	if err := d.discover(); err != nil {
+		return nil, nil, err
+	}
+
+	return d.entryPoints, d.diagnostics, nil
+}
+
+func (d *entryPointDiscovery) discover() error {
+	// Unreadable files and directories of a package are reported, the
+	// rest of the package is still discovered
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == d.root {
+				return err
+			}
+
+			d.diagnostic(path, 0, fmt.Sprintf("Error reading file: %s", err))
+			return nil
+		}
+
+		if entry.IsDir() {
+			if (path != d.root) && skipDirectory(entry.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if err := d.discoverFile(path); err != nil {
+			d.diagnostic(path, 0, fmt.Sprintf("Entry points not discovered: %s", err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.resolveTargets()
+
+	// Install time entry points first, they run without any user action
+	sort.SliceStable(d.entryPoints, func(i, j int) bool {
+		a, b := d.entryPoints[i], d.entryPoints[j]
+		if a.Phase != b.Phase {
+			return a.Phase == entryPointInstall
+		}
+
+		if a.File != b.File {
+			return a.File < b.File
+		}
+
+		return a.Line < b.Line
+	})
+
+	return nil
+}
+
+func (d *entryPointDiscovery) add(ep entryPoint) {
+	d.entryPoints = append(d.entryPoints, ep)
+}
+
+func (d *entryPointDiscovery) diagnostic(file string, line uint32, message string) {
+	d.diagnostics = append(d.diagnostics, diagnostic{
+		File:    file,
+		Line:    line,
+		Message: message,
+	})
+}
+
+func (d *entryPointDiscovery) discoverFile(path string) error {
+	name := filepath.Base(path)
+
+	switch {
+	case name == "setup.py":
+		return d.discoverSetupPy(path)
+	case name == "setup.cfg":
+		return d.discoverSetupCfg(path)
+	case name == "pyproject.toml":
+		return d.discoverPyproject(path)
+	case strings.HasSuffix(name, ".pth"):
+		return d.discoverPth(path)
+	case strings.HasSuffix(name, ".py"):
+		return d.discoverModule(path)
+	}
+
+	return nil
+}
+
+// Path of a file relative to the root, with forward slashes
+func (d *entryPointDiscovery) relative(path string) string {
+	rel, err := filepath.Rel(d.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// Directories modules are imported from, relative to the root
+func (d *entryPointDiscovery) sourceRoots() []string {
+	return append([]string{"src"}, d.backendPaths...)
+}
+
+// Python module name of a file, such as pkg.cli for src/pkg/cli.py
+func (d *entryPointDiscovery) moduleName(path string) string {
+	rel := d.relative(path)
+	for _, dir := range d.sourceRoots() {
+		if prefix := strings.Trim(filepath.ToSlash(dir), "/") + "/"; strings.HasPrefix(rel, prefix) {
+			rel = strings.TrimPrefix(rel, prefix)
+			break
+		}
+	}
+
+	rel = strings.TrimSuffix(rel, ".py")
+	rel = strings.TrimSuffix(rel, "/__init__")
+
+	return strings.ReplaceAll(rel, "/", ".")
+}
+
+// File of a module in the package, if any
+func (d *entryPointDiscovery) moduleFile(module string) (string, bool) {
+	rel := filepath.FromSlash(strings.ReplaceAll(module, ".", "/"))
+
+	for _, dir := range append([]string{""}, d.sourceRoots()...) {
+		for _, candidate := range []string{rel + ".py", filepath.Join(rel, "__init__.py")} {
+			path := filepath.Join(d.root, dir, candidate)
+			if info, err := os.Stat(path); (err == nil) && !info.IsDir() {
+				return path, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (d *entryPointDiscovery) parse(path string) (*Visitor, *sitter.Node, error) {
+	data, cut, err := readSource(path, d.limits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cut {
+		d.diagnostic(path, 0, fmt.Sprintf("File is larger than %d bytes, entry points may be missing",
+			d.limits.maxFileSize))
+	}
+
+	// A parser per file, the cancellation of a parse would otherwise
+	// abort the next parse of a shared parser
+	parser := sitter.NewParser()
+	parser.SetLanguage(python.GetLanguage())
+
+	ctx, cancel := d.limits.context()
+	defer cancel()
+
+	cst, err := parser.ParseCtx(ctx, nil, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root := cst.RootNode()
+	if root == nil {
+		return nil, nil, fmt.Errorf("Error parsing file: root node is nil")
+	}
+
+	if root.HasError() {
+		d.diagnostic(path, 0, "Syntax errors, entry points may be missing")
+	}
+
+	// Only the source is needed to read names and strings
+	return newVisitor(path, data, nil), root, nil
+}
+
+// First line of a node, shortened for reports
+func (v *Visitor) summary(node *sitter.Node) string {
+	source, _, _ := strings.Cut(v.val(node), "\n")
+	source = strings.TrimSpace(source)
+
+	if len(source) > diagnosticSourceMaxLength {
+		source = source[:diagnosticSourceMaxLength] + "..."
+	}
+
+	return source
+}
+
+func nodeLine(node *sitter.Node) uint32 {
+	return node.StartPoint().Row + 1
+}
+
+// Main blocks of any module, __main__.py of packages and import time
+// code of __init__.py
+func (d *entryPointDiscovery) discoverModule(path string) error {
+	v, root, err := d.parse(path)
+	if err != nil {
+		return err
+	}
+
+	module := d.moduleName(path)
+	name := filepath.Base(path)
+
+	if name == "__main__.py" {
+		d.add(entryPoint{
+			Kind:   entryPointMainModule,
+			Phase:  entryPointRun,
+			Name:   strings.TrimSuffix(module, ".__main__"),
+			Target: module,
+			File:   path,
+			Line:   1,
+		})
+	}
+
+	for i := 0; i < int(root.NamedChildCount()); i++ {
+		statement := root.NamedChild(i)
+
+		if v.isMainBlock(statement) {
+			d.add(entryPoint{
+				Kind:   entryPointMain,
+				Phase:  entryPointRun,
+				Name:   "__main__",
+				Target: module,
+				File:   path,
+				Line:   nodeLine(statement),
+			})
+
+			continue
+		}
+
+		if (name == "__init__.py") && isImportTimeCode(statement) {
+			d.add(entryPoint{
+				Kind:   entryPointImportTime,
+				Phase:  entryPointRun,
+				Name:   module,
+				Target: v.summary(statement),
+				File:   path,
+				Line:   nodeLine(statement),
+			})
+		}
+	}
+
+	return nil
+}
+
+// if __name__ == "__main__": in either operand order and quote style
+func (v *Visitor) isMainBlock(node *sitter.Node) bool {
+	if node.Type() != "if_statement" {
+		return false
+	}
+
+	condition := node.ChildByFieldName("condition")
+	if (condition == nil) || (condition.Type() != "comparison_operator") {
+		return false
+	}
+
+	text := strings.NewReplacer(" ", "", "'", `"`, "(", "", ")", "").Replace(v.val(condition))
+	return (text == `__name__=="__main__"`) || (text == `"__main__"==__name__`)
+}
+
+// Top level statements calling code when the module is imported. Class
+// bodies and decorators run at import, function bodies do not
+func isImportTimeCode(node *sitter.Node) bool {
+	switch node.Type() {
+	case "import_statement", "import_from_statement", "future_import_statement", "comment":
+		return false
+	}
+
+	return containsCall(node)
+}
+
+func containsCall(node *sitter.Node) bool {
+	switch node.Type() {
+	case "call":
+		return true
+	case "function_definition", "lambda":
+		return false
+	}
+
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		if containsCall(node.NamedChild(i)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Top level assignments of a module by name, to follow arguments such
+// as entry_points=ENTRY_POINTS
+func (v *Visitor) topLevelAssignments(root *sitter.Node) map[string]*sitter.Node {
+	assignments := make(map[string]*sitter.Node)
+
+	for i := 0; i < int(root.NamedChildCount()); i++ {
+		statement := root.NamedChild(i)
+		if (statement.Type() != "expression_statement") || (statement.NamedChildCount() == 0) {
+			continue
+		}
+
+		assignment := statement.NamedChild(0)
+		if assignment.Type() != "assignment" {
+			continue
+		}
+
+		left := assignment.ChildByFieldName("left")
+		right := assignment.ChildByFieldName("right")
+		if (left != nil) && (right != nil) && (left.Type() == "identifier") {
+			assignments[v.val(left)] = right
+		}
+	}
+
+	return assignments
+}
+
+// Follow identifiers to the value assigned at the top level
+func (v *Visitor) resolveValue(node *sitter.Node, assignments map[string]*sitter.Node) *sitter.Node {
+	for depth := 0; (node != nil) && (node.Type() == "identifier") && (depth < 8); depth++ {
+		value, ok := assignments[v.val(node)]
+		if !ok {
+			break
+		}
+
+		node = value
+	}
+
+	return node
+}
+
+// A key and value of a dict literal or dict(..) call
+type dictionaryItem struct {
+	key   string
+	value *sitter.Node
+}
+
+// Items of a dict literal or dict(..) call with string keys
+func (v *Visitor) dictionaryItems(node *sitter.Node) []dictionaryItem {
+	items := make([]dictionaryItem, 0)
+
+	switch node.Type() {
+	case "dictionary":
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			pair := node.NamedChild(i)
+			if pair.Type() != "pair" {
+				continue
+			}
+
+			key := pair.ChildByFieldName("key")
+			value := pair.ChildByFieldName("value")
+			if (key == nil) || (value == nil) || (key.Type() != "string") {
+				continue
+			}
+
+			if name, ok := v.stringValue(key); ok {
+				items = append(items, dictionaryItem{name, value})
+			}
+		}
+	case "call":
+		function := node.ChildByFieldName("function")
+		if (function == nil) || (v.val(function) != "dict") {
+			break
+		}
+
+		for _, arg := range callArguments(node) {
+			name := arg.ChildByFieldName("name")
+			value := arg.ChildByFieldName("value")
+			if (arg.Type() == "keyword_argument") && (name != nil) && (value != nil) {
+				items = append(items, dictionaryItem{v.val(name), value})
+			}
+		}
+	}
+
+	return items
+}
+
+// Every string of a list, tuple or single string node
+func (v *Visitor) stringLines(node *sitter.Node) []configLine {
+	lines := make([]configLine, 0)
+
+	switch node.Type() {
+	case "string":
+		if value, ok := v.stringValue(node); ok {
+			lines = append(lines, configLine{text: value, line: nodeLine(node)})
+		}
+	case "list", "tuple":
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			lines = append(lines, v.stringLines(node.NamedChild(i))...)
+		}
+	}
+
+	return lines
+}
+
+// The setup script runs at install time, as do the command classes it
+// registers. Entry points and scripts are declared through setup()
+func (d *entryPointDiscovery) discoverSetupPy(path string) error {
+	v, root, err := d.parse(path)
+	if err != nil {
+		return err
+	}
+
+	module := d.moduleName(path)
+
+	d.add(entryPoint{
+		Kind:   entryPointSetupScript,
+		Phase:  entryPointInstall,
+		Target: module,
+		File:   path,
+		Line:   1,
+	})
+
+	assignments := v.topLevelAssignments(root)
+
+	var visit func(node *sitter.Node)
+	visit = func(node *sitter.Node) {
+		if node.Type() == "call" {
+			function := node.ChildByFieldName("function")
+			if (function != nil) && ((v.val(function) == "setup") || strings.HasSuffix(v.val(function), ".setup")) {
+				d.discoverSetupArguments(v, path, module, node, assignments)
+			}
+		}
+
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			visit(node.NamedChild(i))
+		}
+	}
+
+	visit(root)
+	return nil
+}
+
+func (d *entryPointDiscovery) discoverSetupArguments(v *Visitor, path, module string, call *sitter.Node,
+	assignments map[string]*sitter.Node) {
+	for _, arg := range callArguments(call) {
+		name := arg.ChildByFieldName("name")
+		value := arg.ChildByFieldName("value")
+		if (arg.Type() != "keyword_argument") || (name == nil) || (value == nil) {
+			continue
+		}
+
+		value = v.resolveValue(value, assignments)
+
+		switch v.val(name) {
+		case "entry_points":
+			d.discoverSetupEntryPoints(v, path, value, assignments)
+		case "cmdclass":
+			for _, item := range v.dictionaryItems(value) {
+				class := v.resolveValue(item.value, assignments)
+				if (class.Type() != "identifier") && (class.Type() != "attribute") {
+					continue
+				}
+
+				// Classes defined in setup.py are in its module, others
+				// are referenced by their dotted name
+				target := module + ":" + v.val(class)
+				if class.Type() == "attribute" {
+					target = dottedTarget(v.val(class))
+				}
+
+				d.addCommandClass(item.key, target, path, nodeLine(item.value))
+			}
+		case "scripts":
+			for _, script := range v.stringLines(value) {
+				d.add(entryPoint{
+					Kind:   entryPointScript,
+					Phase:  entryPointRun,
+					Name:   filepath.Base(script.text),
+					Target: script.text,
+					File:   path,
+					Line:   script.line,
+				})
+			}
+		}
+	}
+}
+
+// entry_points is a dict of groups to specs, or a string in the
+// entry_points.txt format
+func (d *entryPointDiscovery) discoverSetupEntryPoints(v *Visitor, path string, node *sitter.Node,
+	assignments map[string]*sitter.Node) {
+	if node.Type() == "string" {
+		text, ok := v.stringValue(node)
+		if !ok {
+			return
+		}
+
+		offset := nodeLine(node) - 1
+		for _, section := range parseIni(text) {
+			specs := make([]configLine, 0)
+			for _, option := range section.options {
+				for _, value := range option.value {
+					specs = append(specs, configLine{text: option.key + " = " + value.text, line: value.line + offset})
+				}
+			}
+
+			d.addEntryPointGroup(section.name, path, specs)
+		}
+
+		return
+	}
+
+	for _, item := range v.dictionaryItems(node) {
+		d.addEntryPointGroup(item.key, path, v.stringLines(v.resolveValue(item.value, assignments)))
+	}
+}
+
+func (d *entryPointDiscovery) addCommandClass(command, target, file string, line uint32) {
+	d.add(entryPoint{
+		Kind:   entryPointCommandClass,
+		Phase:  entryPointInstall,
+		Name:   command,
+		Target: target,
+		File:   file,
+		Line:   line,
+	})
+}
+
+// Lines of .pth files starting with import are executed by site.py at
+// every interpreter startup once the file is installed
+func (d *entryPointDiscovery) discoverPth(path string) error {
+	data, _, err := readSource(path, d.limits)
+	if err != nil {
+		return err
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "import ") && !strings.HasPrefix(line, "import\t") {
+			continue
+		}
+
+		if len(line) > diagnosticSourceMaxLength {
+			line = line[:diagnosticSourceMaxLength] + "..."
+		}
+
+		d.add(entryPoint{
+			Kind:   entryPointPth,
+			Phase:  entryPointRun,
+			Name:   filepath.Base(path),
+			Target: line,
+			File:   path,
+			Line:   uint32(i + 1),
+		})
+	}
+
+	return nil
+}
+
+// Find the definitions of entry point targets in the package
+func (d *entryPointDiscovery) resolveTargets() {
+	for i := range d.entryPoints {
+		ep := &d.entryPoints[i]
+
+		switch ep.Kind {
+		case entryPointScript, entryPointPth:
+			continue
+		case entryPointSetupScript, entryPointMain, entryPointMainModule, entryPointImportTime:
+			ep.Definition = d.moduleName(ep.File) + "[" + string(idTypeModule) + "]"
+			continue
+		}
+
+		module, attr, _ := strings.Cut(ep.Target, ":")
+		if id, ok := d.resolveTarget(strings.TrimSpace(module), strings.TrimSpace(attr)); ok {
+			ep.Definition = id
+		}
+	}
+}
+
+func (d *entryPointDiscovery) resolveTarget(module, attr string) (string, bool) {
+	if attr == "" {
+		if _, ok := d.moduleFile(module); ok {
+			return module + "[" + string(idTypeModule) + "]", true
+		}
+
+		return "", false
+	}
+
+	builder, ok := d.module(module)
+	if !ok {
+		return "", false
+	}
+
+	prefix := module + "/" + strings.ReplaceAll(attr, ".", "/")
+	for _, idType := range []idType{idTypeFunction, idTypeClass, idTypeVariable} {
+		id := prefix + "[" + string(idType) + "]"
+		if _, ok := builder.definitionsRegistry[id]; ok {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// Analysis of a module of the package, analyzed once
+func (d *entryPointDiscovery) module(module string) (*AssignmentGraphBuilder, bool) {
+	path, ok := d.moduleFile(module)
+	if !ok {
+		return nil, false
+	}
+
+	builder, ok := d.modules[path]
+	if !ok {
+		var err error
+		if builder, _, err = analyzeFile(module, path, analysisOptions{limits: d.limits}); err != nil {
+			d.diagnostic(path, 0, fmt.Sprintf("Analysis failed: %s", err))
+		} else if t := builder.truncated; t != nil {
+			d.diagnostic(path, t.Line, fmt.Sprintf("Analysis truncated by the %s limit: %s", t.Limit, t.Message))
+		}
+
+		d.modules[path] = builder
+	}
+
+	return builder, builder != nil
+}
+
+func entryPointsCommand(args []string) error {
+	flags := flag.NewFlagSet("entrypoints", flag.ExitOnError)
+	phase := flags.String("phase", "", "Only report entry points of this phase, install or run")
+
+	var limits analysisLimits
+	limits.registerFlags(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s entrypoints [-phase install|run] <package dir>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single package directory")
+	}
+
+	switch entryPointPhase(*phase) {
+	case "", entryPointInstall, entryPointRun:
+	default:
+		return fmt.Errorf("unknown phase %q, expected install or run", *phase)
+	}
+
+	traceOutput = io.Discard
+
+	entryPoints, diagnostics, err := discoverEntryPoints(flags.Arg(0), limits)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range diagnostics {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", d.File, d.Line, d.Message)
+	}
+
+	selected := make([]entryPoint, 0, len(entryPoints))
+	for _, ep := range entryPoints {
+		if (*phase == "") || (string(ep.Phase) == *phase) {
+			selected = append(selected, ep)
+		}
+	}
+
+	jsonEntryPoints, err := json.MarshalIndent(selected, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(jsonEntryPoints))
+	return nil
+}
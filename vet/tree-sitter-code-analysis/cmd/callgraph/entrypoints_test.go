@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEntryPointsGolden(t *testing.T) {
+	entryPoints, diagnostics, err := discoverEntryPoints(filepath.Join("testdata", "package"), analysisLimits{})
+	if err != nil {
+		t.Fatalf("discovering entry points: %v", err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	actual, err := json.MarshalIndent(entryPoints, "", "  ")
+	if err != nil {
+		t.Fatalf("marshalling entry points: %v", err)
+	}
+
+	actual = append(actual, '\n')
+
+	golden := filepath.Join("testdata", "package.entrypoints.golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+
+		return
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file (run go test -update to create): %v", err)
+	}
+
+	if string(expected) != string(actual) {
+		t.Errorf("entry points do not match %s (run go test -update to accept)\nexpected:\n%s\nactual:\n%s",
+			golden, expected, actual)
+	}
+}
+
+func TestEntryPointsUnreadableFile(t *testing.T) {
+	root := t.TempDir()
+
+	setup := "from setuptools import setup\n\n" +
+		"setup(name=\"pkg\", entry_points={\"console_scripts\": [\"cli = pkg:main\"]})\n"
+	if err := os.WriteFile(filepath.Join(root, "setup.py"), []byte(setup), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join(root, "missing.py"), filepath.Join(root, "broken.py")); err != nil {
+		t.Fatal(err)
+	}
+
+	entryPoints, diagnostics, err := discoverEntryPoints(root, analysisLimits{})
+	if err != nil {
+		t.Fatalf("discovering entry points: %v", err)
+	}
+
+	// The broken file is reported, the rest of the package is discovered
+	if (len(diagnostics) != 1) || (diagnostics[0].File != filepath.Join(root, "broken.py")) {
+		t.Errorf("expected a diagnostic for broken.py, got %v", diagnostics)
+	}
+
+	found := false
+	for _, ep := range entryPoints {
+		found = found || ((ep.Kind == entryPointConsoleScript) && (ep.Name == "cli"))
+	}
+
+	if !found {
+		t.Errorf("expected the cli console script, got %v", entryPoints)
+	}
+}
+
+func TestParseEntryPointSpec(t *testing.T) {
+	cases := []struct {
+		spec   string
+		name   string
+		target string
+		ok     bool
+	}{
+		{"cli = pkg.main:run", "cli", "pkg.main:run", true},
+		{"cli=pkg.main:run [extra]", "cli", "pkg.main:run", true},
+		{"pkg.main:run", "", "", false},
+		{" = pkg.main:run", "", "", false},
+	}
+
+	for _, test := range cases {
+		name, target, ok := parseEntryPointSpec(test.spec)
+		if (ok != test.ok) || (ok && ((name != test.name) || (target != test.target))) {
+			t.Errorf("parseEntryPointSpec(%q) = %q, %q, %v, expected %q, %q, %v",
+				test.spec, name, target, ok, test.name, test.target, test.ok)
+		}
+	}
+}
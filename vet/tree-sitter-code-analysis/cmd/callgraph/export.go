@@ -0,0 +1,416 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Normalized schema for analysis results. Every exported file is an
+// analysis so that results of many packages can be aggregated in a
+// single database
+const exportSchema = `
+CREATE TABLE IF NOT EXISTS analyses (
+	id INTEGER PRIMARY KEY,
+	package TEXT NOT NULL,
+	file TEXT NOT NULL,
+	module TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	truncated TEXT
+);
+
+CREATE TABLE IF NOT EXISTS definitions (
+	id INTEGER PRIMARY KEY,
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	def_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE (analysis_id, def_id)
+);
+
+CREATE TABLE IF NOT EXISTS scopes (
+	id INTEGER PRIMARY KEY,
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	owner_id INTEGER REFERENCES definitions(id),
+	parent_id INTEGER REFERENCES scopes(id)
+);
+
+CREATE TABLE IF NOT EXISTS scope_bindings (
+	scope_id INTEGER NOT NULL REFERENCES scopes(id),
+	definition_id INTEGER NOT NULL REFERENCES definitions(id),
+	PRIMARY KEY (scope_id, definition_id)
+);
+
+CREATE TABLE IF NOT EXISTS namespaces (
+	id INTEGER PRIMARY KEY,
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	ns_id TEXT NOT NULL,
+	definition_id INTEGER NOT NULL REFERENCES definitions(id),
+	parent_id INTEGER REFERENCES namespaces(id),
+	scope_id INTEGER REFERENCES scopes(id),
+	UNIQUE (analysis_id, ns_id)
+);
+
+CREATE TABLE IF NOT EXISTS definition_namespaces (
+	definition_id INTEGER PRIMARY KEY REFERENCES definitions(id),
+	namespace_id INTEGER NOT NULL REFERENCES namespaces(id)
+);
+
+CREATE TABLE IF NOT EXISTS class_hierarchy (
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	class_id INTEGER NOT NULL REFERENCES definitions(id),
+	super_id INTEGER NOT NULL REFERENCES definitions(id),
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS assignments (
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	target_id INTEGER NOT NULL REFERENCES definitions(id),
+	value_id INTEGER NOT NULL REFERENCES definitions(id),
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS calls (
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	caller_id INTEGER NOT NULL REFERENCES definitions(id),
+	callee_id INTEGER REFERENCES definitions(id),
+	callee_name TEXT NOT NULL,
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS diagnostics (
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	file TEXT NOT NULL,
+	line INTEGER NOT NULL,
+	col INTEGER NOT NULL,
+	message TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS obfuscation_indicators (
+	analysis_id INTEGER NOT NULL REFERENCES analyses(id),
+	kind TEXT NOT NULL,
+	expression TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	line INTEGER NOT NULL,
+	col INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS definitions_name ON definitions(name);
+CREATE INDEX IF NOT EXISTS calls_caller ON calls(caller_id);
+CREATE INDEX IF NOT EXISTS calls_callee ON calls(callee_id);
+CREATE INDEX IF NOT EXISTS calls_callee_name ON calls(callee_name);
+CREATE INDEX IF NOT EXISTS assignments_target ON assignments(target_id);
+CREATE INDEX IF NOT EXISTS assignments_value ON assignments(value_id);
+`
+
+func openExportDatabase(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(exportSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+
+	return db, nil
+}
+
+// Writes the results held by a builder as a single analysis
+type sqliteExporter struct {
+	tx         *sql.Tx
+	analysisId int64
+
+	definitions map[string]int64
+	scopes      map[*scope]int64
+	namespaces  map[string]int64
+}
+
+func exportAnalysis(db *sql.DB, pkg, file string, builder *AssignmentGraphBuilder,
+	diagnostics []diagnostic) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	e := &sqliteExporter{
+		tx:          tx,
+		definitions: make(map[string]int64),
+		scopes:      make(map[*scope]int64),
+		namespaces:  make(map[string]int64),
+	}
+
+	if err := e.export(pkg, file, builder, diagnostics); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return e.analysisId, tx.Commit()
+}
+
+func (e *sqliteExporter) export(pkg, file string, builder *AssignmentGraphBuilder,
+	diagnostics []diagnostic) error {
+	// The limit that stopped a partial analysis, NULL when complete
+	var truncated any
+	if builder.truncated != nil {
+		truncated = builder.truncated.Limit
+	}
+
+	res, err := e.tx.Exec(`INSERT INTO analyses (package, file, module, created_at, truncated) VALUES (?, ?, ?, ?, ?)`,
+		pkg, file, builder.currentNamespace.id(), time.Now().UTC().Format(time.RFC3339), truncated)
+	if err != nil {
+		return err
+	}
+
+	if e.analysisId, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	ids := sortedKeys(builder.definitionsRegistry)
+	for _, id := range ids {
+		if err := e.exportDefinition(builder.definitionsRegistry[id]); err != nil {
+			return err
+		}
+	}
+
+	// Namespaces and scopes are only reachable through definitions
+	if _, err := e.exportScope(builder.scope); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		def := builder.definitionsRegistry[id]
+
+		if def.ns != nil {
+			nsId, err := e.exportNamespace(def.ns)
+			if err != nil {
+				return err
+			}
+
+			if _, err := e.tx.Exec(`INSERT INTO definition_namespaces (definition_id, namespace_id) VALUES (?, ?)`,
+				e.definitions[id], nsId); err != nil {
+				return err
+			}
+		}
+
+		if def.scope != nil {
+			if _, err := e.exportScope(def.scope); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, class := range sortedKeys(builder.classHierarchy) {
+		for position, super := range builder.classHierarchy[class] {
+			if _, err := e.tx.Exec(`INSERT INTO class_hierarchy (analysis_id, class_id, super_id, position) VALUES (?, ?, ?, ?)`,
+				e.analysisId, e.definitions[class], e.definitions[super], position); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, target := range sortedKeys(builder.assignmentGraph) {
+		for position, value := range builder.assignmentGraph[target] {
+			if _, err := e.tx.Exec(`INSERT INTO assignments (analysis_id, target_id, value_id, position) VALUES (?, ?, ?, ?)`,
+				e.analysisId, e.definitions[target], e.definitions[value], position); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, caller := range sortedKeys(builder.callGraph) {
+		for position, callee := range builder.callGraph[caller] {
+			// Unresolved callees are recorded by name only
+			var calleeId sql.NullInt64
+			calleeName := callee
+
+			if id, ok := e.definitions[callee]; ok {
+				calleeId = sql.NullInt64{Int64: id, Valid: true}
+				calleeName = builder.definitionsRegistry[callee].name
+			}
+
+			if _, err := e.tx.Exec(`INSERT INTO calls (analysis_id, caller_id, callee_id, callee_name, position) VALUES (?, ?, ?, ?, ?)`,
+				e.analysisId, e.definitions[caller], calleeId, calleeName, position); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, d := range diagnostics {
+		if _, err := e.tx.Exec(`INSERT INTO diagnostics (analysis_id, file, line, col, message) VALUES (?, ?, ?, ?, ?)`,
+			e.analysisId, d.File, d.Line, d.Column, d.Message); err != nil {
+			return err
+		}
+	}
+
+	for _, indicator := range builder.obfuscationIndicators {
+		if _, err := e.tx.Exec(`INSERT INTO obfuscation_indicators (analysis_id, kind, expression, namespace, line, col) VALUES (?, ?, ?, ?, ?, ?)`,
+			e.analysisId, indicator.Kind, indicator.Expression, indicator.Namespace,
+			indicator.Line, indicator.Column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *sqliteExporter) exportDefinition(def *definition) error {
+	res, err := e.tx.Exec(`INSERT INTO definitions (analysis_id, def_id, type, name) VALUES (?, ?, ?, ?)`,
+		e.analysisId, def.id(), string(def.idType), def.name)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	e.definitions[def.id()] = id
+	return nil
+}
+
+func (e *sqliteExporter) exportScope(s *scope) (sql.NullInt64, error) {
+	if s == nil {
+		return sql.NullInt64{}, nil
+	}
+
+	if id, ok := e.scopes[s]; ok {
+		return sql.NullInt64{Int64: id, Valid: true}, nil
+	}
+
+	parentId, err := e.exportScope(s.parent)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	var ownerId sql.NullInt64
+	if s.owner != nil {
+		if id, ok := e.definitions[s.owner.id()]; ok {
+			ownerId = sql.NullInt64{Int64: id, Valid: true}
+		}
+	}
+
+	res, err := e.tx.Exec(`INSERT INTO scopes (analysis_id, owner_id, parent_id) VALUES (?, ?, ?)`,
+		e.analysisId, ownerId, parentId)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	e.scopes[s] = id
+
+	for _, defId := range sortedKeys(s.defs) {
+		if _, err := e.tx.Exec(`INSERT OR IGNORE INTO scope_bindings (scope_id, definition_id) VALUES (?, ?)`,
+			id, e.definitions[defId]); err != nil {
+			return sql.NullInt64{}, err
+		}
+	}
+
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
+func (e *sqliteExporter) exportNamespace(ns *namespace) (int64, error) {
+	if id, ok := e.namespaces[ns.id()]; ok {
+		return id, nil
+	}
+
+	var parentId sql.NullInt64
+	if ns.parent != nil {
+		id, err := e.exportNamespace(ns.parent)
+		if err != nil {
+			return 0, err
+		}
+
+		parentId = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	scopeId, err := e.exportScope(ns.scope)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := e.tx.Exec(`INSERT INTO namespaces (analysis_id, ns_id, definition_id, parent_id, scope_id) VALUES (?, ?, ?, ?, ?)`,
+		e.analysisId, ns.id(), e.definitions[ns.definition.id()], parentId, scopeId)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	e.namespaces[ns.id()] = id
+	return id, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "callgraph.db", "SQLite database to write, created when missing")
+	pkg := flags.String("package", "", "Package the files belong to, recorded with each analysis")
+
+	var options analysisOptions
+	flags.IntVar(&options.contextDepth, "k", 0, "Call site sensitivity, clones functions per call context when > 0")
+	options.limits.registerFlags(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [-o <file.db>] [-package <name>] [-k <depth>] <file.py>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("expected files to analyze")
+	}
+
+	traceOutput = io.Discard
+
+	db, err := openExportDatabase(*output)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	for _, file := range flags.Args() {
+		builder, diagnostics, err := analyzeFile(fileToModuleName(file), file, options)
+		if err != nil {
+			return fmt.Errorf("analyzing %s: %w", file, err)
+		}
+
+		analysisId, err := exportAnalysis(db, *pkg, file, builder, diagnostics)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", file, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %s as analysis %d\n", file, analysisId)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportSQLite(t *testing.T) {
+	db, err := openExportDatabase(filepath.Join(t.TempDir(), "callgraph.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+
+	defer db.Close()
+
+	// Exporting twice must produce independent analyses
+	for i := 0; i < 2; i++ {
+		builder, diagnostics, err := analyzeFile("samples.2", filepath.Join("..", "..", "samples", "2.py"), analysisOptions{})
+		if err != nil {
+			t.Fatalf("analyzing sample: %v", err)
+		}
+
+		if _, err := exportAnalysis(db, "samples", "samples/2.py", builder, diagnostics); err != nil {
+			t.Fatalf("exporting analysis: %v", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT c.name, s.name FROM class_hierarchy h
+		JOIN definitions c ON c.id = h.class_id
+		JOIN definitions s ON s.id = h.super_id
+		WHERE h.analysis_id = 2 ORDER BY h.position`)
+	if err != nil {
+		t.Fatalf("querying class hierarchy: %v", err)
+	}
+
+	defer rows.Close()
+
+	hierarchy := make([]string, 0)
+	for rows.Next() {
+		var class, super string
+		if err := rows.Scan(&class, &super); err != nil {
+			t.Fatalf("scanning class hierarchy: %v", err)
+		}
+
+		hierarchy = append(hierarchy, class+"->"+super)
+	}
+
+	if expected := []string{"C->A", "C->B"}; !reflect.DeepEqual(hierarchy, expected) {
+		t.Errorf("expected class hierarchy %v, got %v", expected, hierarchy)
+	}
+
+	var unresolved, resolved int
+	if err := db.QueryRow(`SELECT
+		COUNT(*) FILTER (WHERE callee_id IS NULL),
+		COUNT(*) FILTER (WHERE callee_id IS NOT NULL)
+		FROM calls WHERE analysis_id = 1`).Scan(&unresolved, &resolved); err != nil {
+		t.Fatalf("querying calls: %v", err)
+	}
+
+	if (resolved != 6) || (unresolved != 2) {
+		t.Errorf("expected 6 resolved and 2 unresolved calls, got %d and %d", resolved, unresolved)
+	}
+
+	var module string
+	if err := db.QueryRow(`SELECT n.ns_id FROM namespaces n
+		JOIN definitions d ON d.id = n.definition_id
+		WHERE n.parent_id IS NULL AND n.analysis_id = 1`).Scan(&module); err != nil {
+		t.Fatalf("querying namespaces: %v", err)
+	}
+
+	if module != "samples.2" {
+		t.Errorf("expected root namespace samples.2, got %s", module)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+// Graphs are given by a successor function so that passes can skip edges,
+// such as the ones leaving objects. Traversals terminate on cycles and do
+// not recurse, chains built by untrusted code may be arbitrarily deep
+
+// Visit the nodes reachable from the roots breadth first, each node once.
+// The parent is the node a node was first reached from, empty for roots.
+// Successors of a node are not followed when visit returns false
+func breadthFirst(roots []string, next func(string) []string, visit func(node, parent string) bool) {
+	type queued struct {
+		node   string
+		parent string
+	}
+
+	visited := make(map[string]bool)
+	queue := make([]queued, 0, len(roots))
+
+	for _, root := range roots {
+		if !visited[root] {
+			visited[root] = true
+			queue = append(queue, queued{node: root})
+		}
+	}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		if !visit(item.node, item.parent) {
+			continue
+		}
+
+		for _, successor := range next(item.node) {
+			if !visited[successor] {
+				visited[successor] = true
+				queue = append(queue, queued{node: successor, parent: item.node})
+			}
+		}
+	}
+}
+
+// Visit the nodes reachable from the roots depth first in preorder, each
+// node once. Successors are visited in order, as a recursive search would.
+// Successors of a node are not followed when visit returns false
+func depthFirst(roots []string, next func(string) []string, visit func(node string) bool) {
+	visited := make(map[string]bool)
+
+	stack := make([]string, 0, len(roots))
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, roots[i])
+	}
+
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if visited[node] {
+			continue
+		}
+
+		visited[node] = true
+		if !visit(node) {
+			continue
+		}
+
+		successors := next(node)
+		for i := len(successors) - 1; i >= 0; i-- {
+			if !visited[successors[i]] {
+				stack = append(stack, successors[i])
+			}
+		}
+	}
+}
+
+// Strongly connected components of a graph and the edges between them,
+// which form a directed acyclic graph
+type condensation struct {
+	// Components in reverse topological order, every component comes
+	// after the components it has edges to
+	components [][]string
+
+	// Index of the component of each node
+	component map[string]int
+
+	// Successors of each component, without self loops
+	edges [][]int
+}
+
+// Condense the graph reachable from the nodes with Tarjan's algorithm
+func condense(nodes []string, next func(string) []string) *condensation {
+	c := &condensation{component: make(map[string]int)}
+
+	type frame struct {
+		node       string
+		successors []string
+		i          int
+	}
+
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+
+	push := func(node string) *frame {
+		index[node] = len(index)
+		lowlink[node] = index[node]
+		onStack[node] = true
+		stack = append(stack, node)
+
+		return &frame{node: node, successors: next(node)}
+	}
+
+	for _, root := range nodes {
+		if _, ok := index[root]; ok {
+			continue
+		}
+
+		frames := []*frame{push(root)}
+		for len(frames) > 0 {
+			f := frames[len(frames)-1]
+
+			if f.i < len(f.successors) {
+				successor := f.successors[f.i]
+				f.i++
+
+				if _, ok := index[successor]; !ok {
+					frames = append(frames, push(successor))
+				} else if onStack[successor] {
+					lowlink[f.node] = min(lowlink[f.node], index[successor])
+				}
+
+				continue
+			}
+
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1].node
+				lowlink[parent] = min(lowlink[parent], lowlink[f.node])
+			}
+
+			if lowlink[f.node] != index[f.node] {
+				continue
+			}
+
+			component := make([]string, 0)
+			for {
+				node := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[node] = false
+
+				c.component[node] = len(c.components)
+				component = append(component, node)
+
+				if node == f.node {
+					break
+				}
+			}
+
+			c.components = append(c.components, component)
+		}
+	}
+
+	c.edges = make([][]int, len(c.components))
+	for i, component := range c.components {
+		seen := map[int]bool{i: true}
+		for _, node := range component {
+			for _, successor := range next(node) {
+				if j := c.component[successor]; !seen[j] {
+					seen[j] = true
+					c.edges[i] = append(c.edges[i], j)
+				}
+			}
+		}
+	}
+
+	return c
+}
+
+// Union of the seeds of the nodes reachable from each node, the node
+// itself included. Sets are computed once per strongly connected component
+// from the sets of its successors, and shared by the nodes of the
+// component, so they must not be modified. Nodes without seeds reachable
+// are left out
+func transitiveClosure(nodes []string, next func(string) []string,
+	seed func(string) []string) map[string]map[string]bool {
+	c := condense(nodes, next)
+
+	sets := make([]map[string]bool, len(c.components))
+	closure := make(map[string]map[string]bool)
+
+	for i, component := range c.components {
+		set := make(map[string]bool)
+		for _, node := range component {
+			for _, s := range seed(node) {
+				set[s] = true
+			}
+		}
+
+		// Successors come first in reverse topological order
+		for _, j := range c.edges[i] {
+			for s := range sets[j] {
+				set[s] = true
+			}
+		}
+
+		sets[i] = set
+		if len(set) == 0 {
+			continue
+		}
+
+		for _, node := range component {
+			closure[node] = set
+		}
+	}
+
+	return closure
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCondense(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b"},
+		"b": {"a", "c"},
+		"c": {"c", "d"},
+		"e": {"d", "a"},
+	}
+
+	next := func(node string) []string { return graph[node] }
+	c := condense([]string{"a", "e"}, next)
+
+	components := make([]string, 0)
+	for _, component := range c.components {
+		sorted := append([]string{}, component...)
+		sort.Strings(sorted)
+		components = append(components, strings.Join(sorted, ","))
+	}
+
+	if actual := strings.Join(components, " "); actual != "d c a,b e" {
+		t.Errorf("expected components in reverse topological order d c a,b e, got %s", actual)
+	}
+
+	for i := range c.components {
+		for _, j := range c.edges[i] {
+			if j >= i {
+				t.Errorf("edge from component %d to %d is not in reverse topological order", i, j)
+			}
+		}
+	}
+}
+
+func TestTransitiveClosure(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b"},
+		"b": {"a", "c"},
+		"c": {"c"},
+		"d": {"a"},
+	}
+
+	next := func(node string) []string { return graph[node] }
+	seed := func(node string) []string {
+		if node == "c" {
+			return []string{"object"}
+		}
+
+		return nil
+	}
+
+	closure := transitiveClosure([]string{"a", "b", "c", "d", "e"}, next, seed)
+
+	for _, node := range []string{"a", "b", "c", "d"} {
+		if !closure[node]["object"] || (len(closure[node]) != 1) {
+			t.Errorf("closure of %s: expected object, got %v", node, closure[node])
+		}
+	}
+
+	if _, ok := closure["e"]; ok {
+		t.Errorf("expected no closure for e, got %v", closure["e"])
+	}
+}
+
+func TestTraversals(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b", "c"},
+		"b": {"d", "a"},
+		"c": {"d"},
+		"d": {"b"},
+	}
+
+	next := func(node string) []string { return graph[node] }
+
+	order := make([]string, 0)
+	parents := make(map[string]string)
+	breadthFirst([]string{"a"}, next, func(node, parent string) bool {
+		order = append(order, node)
+		parents[node] = parent
+		return true
+	})
+
+	if actual := strings.Join(order, ","); actual != "a,b,c,d" {
+		t.Errorf("breadth first: expected a,b,c,d, got %s", actual)
+	}
+
+	if parents["d"] != "b" {
+		t.Errorf("breadth first: expected d reached from b, got %s", parents["d"])
+	}
+
+	order = order[:0]
+	depthFirst([]string{"a"}, next, func(node string) bool {
+		order = append(order, node)
+		return node != "b"
+	})
+
+	if actual := strings.Join(order, ","); actual != "a,b,c,d" {
+		t.Errorf("depth first: expected a,b,c,d, got %s", actual)
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	path := filepath.Join("testdata", "recursion.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	for _, variable := range []string{"a", "b", "x", "walk/node"} {
+		id := "testdata.recursion/" + variable + "[variable]"
+		if actual := strings.Join(builder.pointsTo[id], ","); actual != "testdata.recursion/A[class]" {
+			t.Errorf("points-to of %s: expected testdata.recursion/A[class], got %s", id, actual)
+		}
+	}
+
+	// Both paths from both lead to the same constant
+	if len(builder.obfuscationIndicators) > 0 {
+		t.Errorf("unexpected obfuscation indicators: %v", builder.obfuscationIndicators)
+	}
+
+	module := builder.definitionsRegistry["testdata.recursion/module[variable]"]
+	if value, ok := builder.referenceValue(module); !ok || (value != "sys") {
+		t.Errorf("expected module to reference sys, got %q", value)
+	}
+}
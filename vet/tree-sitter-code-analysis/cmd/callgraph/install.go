@@ -0,0 +1,655 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Categories of sinks reached at install time
+const (
+	sinkNetwork    = "network"
+	sinkProcess    = "process"
+	sinkFilesystem = "filesystem"
+	sinkCode       = "code"
+)
+
+// Functions acting on the outside world, by dotted name after import
+// aliases are expanded
+var installSinks = map[string]string{
+	"urlopen":                         sinkNetwork,
+	"urllib.urlopen":                  sinkNetwork,
+	"urllib.urlretrieve":              sinkNetwork,
+	"urllib2.urlopen":                 sinkNetwork,
+	"urllib.request.urlopen":          sinkNetwork,
+	"urllib.request.urlretrieve":      sinkNetwork,
+	"http.client.HTTPConnection":      sinkNetwork,
+	"http.client.HTTPSConnection":     sinkNetwork,
+	"httplib.HTTPConnection":          sinkNetwork,
+	"httplib.HTTPSConnection":         sinkNetwork,
+	"os.system":                       sinkProcess,
+	"os.popen":                        sinkProcess,
+	"os.startfile":                    sinkProcess,
+	"pty.spawn":                       sinkProcess,
+	"commands.getoutput":              sinkProcess,
+	"commands.getstatusoutput":        sinkProcess,
+	"os.remove":                       sinkFilesystem,
+	"os.unlink":                       sinkFilesystem,
+	"os.rename":                       sinkFilesystem,
+	"os.replace":                      sinkFilesystem,
+	"os.mkdir":                        sinkFilesystem,
+	"os.makedirs":                     sinkFilesystem,
+	"os.rmdir":                        sinkFilesystem,
+	"os.removedirs":                   sinkFilesystem,
+	"os.chmod":                        sinkFilesystem,
+	"os.chown":                        sinkFilesystem,
+	"os.symlink":                      sinkFilesystem,
+	"os.link":                         sinkFilesystem,
+	"os.write":                        sinkFilesystem,
+	"shutil.copy":                     sinkFilesystem,
+	"shutil.copy2":                    sinkFilesystem,
+	"shutil.copyfile":                 sinkFilesystem,
+	"shutil.copytree":                 sinkFilesystem,
+	"shutil.move":                     sinkFilesystem,
+	"shutil.rmtree":                   sinkFilesystem,
+	"exec":                            sinkCode,
+	"eval":                            sinkCode,
+	"compile":                         sinkCode,
+	"__import__":                      sinkCode,
+	"importlib.import_module":         sinkCode,
+	"marshal.loads":                   sinkCode,
+	"pickle.loads":                    sinkCode,
+	"ctypes.CDLL":                     sinkCode,
+	"ctypes.cdll.LoadLibrary":         sinkCode,
+	"ctypes.windll.LoadLibrary":       sinkCode,
+	"webbrowser.open":                 sinkNetwork,
+	"smtplib.SMTP":                    sinkNetwork,
+	"smtplib.SMTP_SSL":                sinkNetwork,
+	"ftplib.FTP":                      sinkNetwork,
+	"telnetlib.Telnet":                sinkNetwork,
+	"xmlrpc.client.ServerProxy":       sinkNetwork,
+	"socket.socket":                   sinkNetwork,
+	"socket.create_connection":        sinkNetwork,
+	"socket.getaddrinfo":              sinkNetwork,
+	"socket.gethostbyname":            sinkNetwork,
+	"asyncio.open_connection":         sinkNetwork,
+	"asyncio.create_subprocess_exec":  sinkProcess,
+	"asyncio.create_subprocess_shell": sinkProcess,
+}
+
+// Modules where any call is a sink
+var installSinkModules = map[string]string{
+	"requests":   sinkNetwork,
+	"httpx":      sinkNetwork,
+	"urllib3":    sinkNetwork,
+	"aiohttp":    sinkNetwork,
+	"paramiko":   sinkNetwork,
+	"subprocess": sinkProcess,
+}
+
+// Methods matched on any receiver, since the type of objects such as
+// pathlib paths and sockets is not tracked
+var installSinkMethods = map[string]string{
+	"write_text":  sinkFilesystem,
+	"write_bytes": sinkFilesystem,
+	"sendall":     sinkNetwork,
+}
+
+// Functions whose prefix names a family of process calls, as os.execv
+// and os.spawnl
+var installSinkPrefixes = map[string]string{
+	"os.exec":        sinkProcess,
+	"os.spawn":       sinkProcess,
+	"os.posix_spawn": sinkProcess,
+}
+
+// Builtins opening files, writes depend on the mode argument
+var openFunctions = map[string]bool{
+	"open":          true,
+	"io.open":       true,
+	"builtins.open": true,
+	"codecs.open":   true,
+}
+
+// Hooks of PEP 517 and PEP 660 called by pip on the build backend
+var buildBackendHooks = []string{
+	"get_requires_for_build_wheel",
+	"get_requires_for_build_sdist",
+	"get_requires_for_build_editable",
+	"prepare_metadata_for_build_wheel",
+	"prepare_metadata_for_build_editable",
+	"build_wheel",
+	"build_sdist",
+	"build_editable",
+}
+
+// A sink reachable from an install time entry point
+type installTimeFinding struct {
+	EntryPoint entryPoint `json:"entry_point"`
+	Category   string     `json:"category"`
+
+	// Dotted name of the sink with import aliases expanded
+	Sink string `json:"sink"`
+
+	// Callee as written in the source
+	Call string `json:"call"`
+
+	Caller string `json:"caller"`
+	File   string `json:"file"`
+	Line   uint32 `json:"line"`
+
+	// Definition ids from the entry point to the caller
+	Path []string `json:"path"`
+}
+
+type installTimeReport struct {
+	Package     string               `json:"package"`
+	EntryPoints []entryPoint         `json:"entry_points"`
+	Findings    []installTimeFinding `json:"findings"`
+	Diagnostics []diagnostic         `json:"diagnostics"`
+}
+
+// A module of the package with the facts of its source the call graph
+// does not keep
+type installModule struct {
+	name    string
+	path    string
+	builder *AssignmentGraphBuilder
+
+	// Local names of imports to the dotted names they refer to
+	aliases map[string]string
+
+	// Modules imported at the top level
+	imports []string
+
+	// Lines of calls opening files for writing
+	writeLines map[uint32]bool
+}
+
+type installTimeDetector struct {
+	discovery *entryPointDiscovery
+	modules   map[string]*installModule
+	findings  []installTimeFinding
+}
+
+// Report the sinks reachable from install time entry points of a
+// package source tree
+func detectInstallTimeExecution(root string, limits analysisLimits) (*installTimeReport, error) {
+	discovery := newEntryPointDiscovery(root, limits)
+	if err := discovery.discover(); err != nil {
+		return nil, err
+	}
+
+	detector := &installTimeDetector{
+		discovery: discovery,
+		modules:   make(map[string]*installModule),
+		findings:  make([]installTimeFinding, 0),
+	}
+
+	report := &installTimeReport{
+		Package:     root,
+		EntryPoints: make([]entryPoint, 0),
+	}
+
+	for _, ep := range discovery.entryPoints {
+		if ep.Phase != entryPointInstall {
+			continue
+		}
+
+		report.EntryPoints = append(report.EntryPoints, ep)
+		detector.reach(ep)
+	}
+
+	report.Findings = detector.findings
+	report.Diagnostics = discovery.diagnostics
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+
+		return a.Line < b.Line
+	})
+
+	return report, nil
+}
+
+// Module of the package by name, nil when not part of the package
+func (t *installTimeDetector) module(name string) *installModule {
+	if module, ok := t.modules[name]; ok {
+		return module
+	}
+
+	var module *installModule
+	if builder, ok := t.discovery.module(name); ok {
+		path, _ := t.discovery.moduleFile(name)
+		module = &installModule{
+			name:       name,
+			path:       path,
+			builder:    builder,
+			aliases:    make(map[string]string),
+			writeLines: make(map[uint32]bool),
+		}
+
+		// The tree of the analysis, only the source is needed to read
+		// names and strings
+		if builder.tree != nil {
+			module.collectSourceFacts(newVisitor(path, builder.source, nil), builder.tree.RootNode())
+		} else {
+			t.discovery.diagnostic(path, 0, "File not parsed, install time findings may be missing")
+		}
+	}
+
+	t.modules[name] = module
+	return module
+}
+
+// Definitions executed first when an entry point runs
+func (t *installTimeDetector) roots(ep entryPoint) (*installModule, []string) {
+	module, attr, _ := strings.Cut(ep.Target, ":")
+	if ep.Definition == "" {
+		return nil, nil
+	}
+
+	m := t.module(strings.TrimSpace(module))
+	if m == nil {
+		return nil, nil
+	}
+
+	roots := []string{ep.Definition}
+
+	switch ep.Kind {
+	case entryPointCommandClass:
+		// setuptools may call any method of a command, such as run,
+		// initialize_options and finalize_options
+		prefix := strings.TrimSuffix(ep.Definition, "["+string(idTypeClass)+"]") + "/"
+		for _, id := range sortedKeys(m.builder.definitionsRegistry) {
+			def := m.builder.definitionsRegistry[id]
+			if (def.idType == idTypeFunction) && strings.HasPrefix(id, prefix) &&
+				!strings.Contains(strings.TrimPrefix(id, prefix), "/") {
+				roots = append(roots, id)
+			}
+		}
+	case entryPointBuildBackend:
+		object := m.name
+		if attr != "" {
+			object += "/" + strings.ReplaceAll(strings.TrimSpace(attr), ".", "/")
+		}
+
+		for _, hook := range buildBackendHooks {
+			id := object + "/" + hook + "[" + string(idTypeFunction) + "]"
+			if _, ok := m.builder.definitionsRegistry[id]; ok {
+				roots = append(roots, id)
+			}
+		}
+	}
+
+	return m, roots
+}
+
+// A definition reached from an entry point
+type reachedDefinition struct {
+	module *installModule
+	id     string
+	parent *reachedDefinition
+}
+
+func (r *reachedDefinition) path() []string {
+	path := make([]string, 0)
+	for node := r; node != nil; node = node.parent {
+		path = append([]string{node.id}, path...)
+	}
+
+	return path
+}
+
+// Breadth first search over the call graphs of the package modules,
+// crossing into modules imported from the package
+func (t *installTimeDetector) reach(ep entryPoint) {
+	module, roots := t.roots(ep)
+	if module == nil {
+		return
+	}
+
+	// Ids are qualified by their module, so they are unique across modules
+	modules := make(map[string]*installModule)
+	reached := make(map[string]*reachedDefinition)
+
+	for _, root := range roots {
+		modules[root] = module
+	}
+
+	next := func(id string) []string {
+		node := reached[id]
+		successors := make([]string, 0)
+
+		add := func(m *installModule, successor string) {
+			modules[successor] = m
+			successors = append(successors, successor)
+		}
+
+		// Importing a module of the package runs its top level
+		if id == node.module.name+"["+string(idTypeModule)+"]" {
+			for _, imported := range node.module.imports {
+				if m := t.module(imported); m != nil {
+					add(m, imported+"["+string(idTypeModule)+"]")
+				}
+			}
+		}
+
+		for _, callee := range node.module.builder.callGraph[id] {
+			if _, ok := node.module.builder.definitionsRegistry[callee]; ok {
+				add(node.module, callee)
+				continue
+			}
+
+			name := node.module.expandAlias(callee)
+			if category, ok := sinkCategory(name); ok {
+				t.addFinding(ep, node, category, name, callee)
+				continue
+			}
+
+			if m, id, ok := t.resolveDotted(name); ok {
+				add(m, id)
+			}
+		}
+
+		return successors
+	}
+
+	breadthFirst(roots, next, func(id, parent string) bool {
+		reached[id] = &reachedDefinition{module: modules[id], id: id, parent: reached[parent]}
+		return true
+	})
+}
+
+func (t *installTimeDetector) addFinding(ep entryPoint, node *reachedDefinition, category, sink, call string) {
+	lines := node.module.builder.callLines[callLinesKey(node.id, call)]
+
+	// Opening files is only a sink when writing
+	if openFunctions[sink] {
+		writes := make([]uint32, 0)
+		for _, line := range lines {
+			if node.module.writeLines[line] {
+				writes = append(writes, line)
+			}
+		}
+
+		if len(writes) == 0 {
+			return
+		}
+
+		lines = writes
+	}
+
+	var line uint32
+	if len(lines) > 0 {
+		line = lines[0]
+	}
+
+	for _, finding := range t.findings {
+		if (finding.EntryPoint == ep) && (finding.Caller == node.id) && (finding.Sink == sink) && (finding.Line == line) {
+			return
+		}
+	}
+
+	t.findings = append(t.findings, installTimeFinding{
+		EntryPoint: ep,
+		Category:   category,
+		Sink:       sink,
+		Call:       call,
+		Caller:     node.id,
+		File:       node.module.path,
+		Line:       line,
+		Path:       node.path(),
+	})
+}
+
+// Find a definition of the package by its dotted name, such as
+// pkg.hooks.run imported with from pkg.hooks import run
+func (t *installTimeDetector) resolveDotted(name string) (*installModule, string, bool) {
+	parts := strings.Split(name, ".")
+	for i := len(parts); i > 0; i-- {
+		moduleName := strings.Join(parts[:i], ".")
+		if _, ok := t.discovery.moduleFile(moduleName); !ok {
+			continue
+		}
+
+		m := t.module(moduleName)
+		if m == nil {
+			return nil, "", false
+		}
+
+		if i == len(parts) {
+			return m, moduleName + "[" + string(idTypeModule) + "]", true
+		}
+
+		id, ok := t.discovery.resolveTarget(moduleName, strings.Join(parts[i:], "."))
+		return m, id, ok
+	}
+
+	return nil, "", false
+}
+
+func sinkCategory(name string) (string, bool) {
+	if category, ok := installSinks[name]; ok {
+		return category, true
+	}
+
+	if openFunctions[name] {
+		return sinkFilesystem, true
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) > 1 {
+		if category, ok := installSinkModules[parts[0]]; ok {
+			return category, true
+		}
+
+		if category, ok := installSinkMethods[parts[len(parts)-1]]; ok {
+			return category, true
+		}
+	}
+
+	for _, prefix := range sortedKeys(installSinkPrefixes) {
+		if strings.HasPrefix(name, prefix) {
+			return installSinkPrefixes[prefix], true
+		}
+	}
+
+	return "", false
+}
+
+// Expand the import alias of the first name of a dotted callee
+func (m *installModule) expandAlias(name string) string {
+	first, rest, dotted := strings.Cut(name, ".")
+	target, ok := m.aliases[first]
+	if !ok {
+		return name
+	}
+
+	if dotted {
+		return target + "." + rest
+	}
+
+	return target
+}
+
+// Collect imports and file writes from the source of the module
+func (m *installModule) collectSourceFacts(v *Visitor, root *sitter.Node) {
+	var visit func(node *sitter.Node, topLevel bool)
+	visit = func(node *sitter.Node, topLevel bool) {
+		switch node.Type() {
+		case "import_statement":
+			for i := 0; i < int(node.NamedChildCount()); i++ {
+				m.addImport(v, node.NamedChild(i), "", topLevel)
+			}
+		case "import_from_statement":
+			moduleNode := node.ChildByFieldName("module_name")
+			if moduleNode == nil {
+				break
+			}
+
+			from := m.absoluteModule(v.val(moduleNode))
+			if topLevel {
+				m.imports = append(m.imports, from)
+			}
+
+			for i := 0; i < int(node.NamedChildCount()); i++ {
+				if child := node.NamedChild(i); child != moduleNode {
+					m.addImport(v, child, from, topLevel)
+				}
+			}
+		case "call":
+			if v.isWriteOpen(node) {
+				m.writeLines[nodeLine(node)] = true
+			}
+		case "function_definition", "class_definition":
+			topLevel = false
+		}
+
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			visit(node.NamedChild(i), topLevel)
+		}
+	}
+
+	visit(root, true)
+}
+
+func (m *installModule) addImport(v *Visitor, node *sitter.Node, from string, topLevel bool) {
+	var name, alias string
+
+	switch node.Type() {
+	case "dotted_name":
+		name = v.val(node)
+	case "aliased_import":
+		nameNode := node.ChildByFieldName("name")
+		aliasNode := node.ChildByFieldName("alias")
+		if (nameNode == nil) || (aliasNode == nil) {
+			return
+		}
+
+		name, alias = v.val(nameNode), v.val(aliasNode)
+	default:
+		return
+	}
+
+	if from != "" {
+		if alias == "" {
+			alias = name
+		}
+
+		m.aliases[alias] = from + "." + name
+		return
+	}
+
+	if topLevel {
+		m.imports = append(m.imports, name)
+	}
+
+	if alias != "" {
+		m.aliases[alias] = name
+	}
+}
+
+// Resolve a relative module name such as ..util against the module
+func (m *installModule) absoluteModule(name string) string {
+	dots := len(name) - len(strings.TrimLeft(name, "."))
+	if dots == 0 {
+		return name
+	}
+
+	// Packages are their own base for relative imports
+	parts := strings.Split(m.name, ".")
+	if !strings.HasSuffix(m.path, "__init__.py") {
+		parts = parts[:len(parts)-1]
+	}
+
+	if dots-1 > len(parts) {
+		return strings.TrimLeft(name, ".")
+	}
+
+	base := strings.Join(parts[:len(parts)-(dots-1)], ".")
+	if rest := strings.TrimLeft(name, "."); rest != "" {
+		if base == "" {
+			return rest
+		}
+
+		return base + "." + rest
+	}
+
+	return base
+}
+
+// Calls to open with a mode writing, appending or creating the file
+func (v *Visitor) isWriteOpen(node *sitter.Node) bool {
+	function := node.ChildByFieldName("function")
+	if (function == nil) || !openFunctions[v.val(function)] {
+		return false
+	}
+
+	for i, arg := range callArguments(node) {
+		mode := arg
+		if arg.Type() == "keyword_argument" {
+			if name := arg.ChildByFieldName("name"); (name == nil) || (v.val(name) != "mode") {
+				continue
+			}
+
+			mode = arg.ChildByFieldName("value")
+		} else if i != 1 {
+			continue
+		}
+
+		if (mode == nil) || (mode.Type() != "string") {
+			return false
+		}
+
+		value, ok := v.stringValue(mode)
+		return ok && strings.ContainsAny(value, "wax+")
+	}
+
+	return false
+}
+
+func installTimeCommand(args []string) error {
+	flags := flag.NewFlagSet("installtime", flag.ExitOnError)
+
+	var limits analysisLimits
+	limits.registerFlags(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s installtime <package dir>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single package directory")
+	}
+
+	traceOutput = io.Discard
+
+	report, err := detectInstallTimeExecution(flags.Arg(0), limits)
+	if err != nil {
+		return err
+	}
+
+	jsonReport, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(jsonReport))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallTimeExecution(t *testing.T) {
+	report, err := detectInstallTimeExecution(filepath.Join("testdata", "installer"), analysisLimits{})
+	if err != nil {
+		t.Fatalf("detecting install time execution: %v", err)
+	}
+
+	actual := make([]string, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		actual = append(actual, fmt.Sprintf("%s %s %s %s:%d via %s",
+			finding.EntryPoint.Kind, finding.Category, finding.Sink,
+			filepath.Base(finding.File), finding.Line, strings.Join(finding.Path, " -> ")))
+	}
+
+	expected := []string{
+		"setup_script network urllib.request.urlopen hooks.py:5 via setup[module] -> hooks/fetch[function]",
+		"setup_script filesystem open setup.py:10 via setup[module]",
+		"cmdclass process subprocess.check_call setup.py:19 via setup/Develop/run[function]",
+		"cmdclass filesystem shutil.rmtree setup.py:23 via setup/Develop/cleanup[function]",
+	}
+
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("findings do not match\nexpected:\n%s\nactual:\n%s",
+			strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestSinkCategory(t *testing.T) {
+	cases := []struct {
+		name     string
+		category string
+	}{
+		{"os.system", sinkProcess},
+		{"os.execvp", sinkProcess},
+		{"subprocess.Popen", sinkProcess},
+		{"requests.post", sinkNetwork},
+		{"urllib.request.urlopen", sinkNetwork},
+		{"path.write_text", sinkFilesystem},
+		{"exec", sinkCode},
+		{"os.path.join", ""},
+		{"print", ""},
+	}
+
+	for _, test := range cases {
+		category, _ := sinkCategory(test.name)
+		if category != test.category {
+			t.Errorf("sinkCategory(%q) = %q, expected %q", test.name, category, test.category)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Limits hit while analyzing a file
+const (
+	limitFileSize    = "max_file_size"
+	limitNodes       = "max_nodes"
+	limitDefinitions = "max_definitions"
+	limitTimeout     = "timeout"
+)
+
+// Limits of the analysis of a file. Packages from public registries may
+// contain files crafted to exhaust memory or time, the analysis stops at
+// the first limit hit and keeps what was built so far. Zero disables a
+// limit
+type analysisLimits struct {
+	// Bytes of source read, longer files are cut at a line break
+	maxFileSize int64
+
+	// Syntax tree nodes visited, including code passed to exec(..)
+	maxNodes int
+
+	// Definitions created, including the clones of functions
+	maxDefinitions int
+
+	// Wall clock time of parsing, visiting and resolving
+	timeout time.Duration
+}
+
+// Limits of the commands unless overridden by flags
+var defaultAnalysisLimits = analysisLimits{
+	maxFileSize:    8 << 20,
+	maxNodes:       2000000,
+	maxDefinitions: 500000,
+	timeout:        time.Minute,
+}
+
+// Register flags overriding the default limits
+func (l *analysisLimits) registerFlags(flags *flag.FlagSet) {
+	*l = defaultAnalysisLimits
+
+	flags.Int64Var(&l.maxFileSize, "max-file-size", l.maxFileSize, "Maximum bytes of a file analyzed, 0 for no limit")
+	flags.IntVar(&l.maxNodes, "max-nodes", l.maxNodes, "Maximum syntax tree nodes visited per file, 0 for no limit")
+	flags.IntVar(&l.maxDefinitions, "max-definitions", l.maxDefinitions,
+		"Maximum definitions created per file, 0 for no limit")
+	flags.DurationVar(&l.timeout, "timeout", l.timeout, "Maximum time spent on a file, 0 for no limit")
+}
+
+// Context of the analysis of a file, cancelled once the timeout expires.
+// Without a timeout it is never cancelled
+func (l analysisLimits) context() (context.Context, context.CancelFunc) {
+	if l.timeout <= 0 {
+		return context.Background(), func() {}
+	}
+
+	return context.WithTimeout(context.Background(), l.timeout)
+}
+
+// The first limit hit while analyzing a file. Results cover the part of
+// the file analyzed before, up to the position when it is known
+type truncation struct {
+	Limit   string `json:"limit"`
+	Message string `json:"message"`
+	Line    uint32 `json:"line,omitempty"`
+	Column  uint32 `json:"column,omitempty"`
+}
+
+// Read a source file up to the size limit. Longer files are cut after the
+// last line break before the limit, so that the statements kept are whole
+func readSource(path string, limits analysisLimits) ([]byte, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer file.Close()
+
+	if limits.maxFileSize <= 0 {
+		data, err := io.ReadAll(file)
+		return data, false, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, limits.maxFileSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(data)) <= limits.maxFileSize {
+		return data, false, nil
+	}
+
+	data = data[:limits.maxFileSize]
+	if end := bytes.LastIndexByte(data, '\n'); end >= 0 {
+		data = data[:end+1]
+	}
+
+	return data, true, nil
+}
+
+// Record the first limit hit, the analysis stops there
+func (b *AssignmentGraphBuilder) truncate(limit string, node *sitter.Node, format string, args ...any) {
+	if b.truncated != nil {
+		return
+	}
+
+	b.truncated = &truncation{
+		Limit:   limit,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	if node != nil {
+		b.truncated.Line = node.StartPoint().Row + 1
+		b.truncated.Column = node.StartPoint().Column + 1
+	}
+
+	tracef("Analysis truncated: %s\n", b.truncated.Message)
+}
+
+// Check the limits before doing more work. The node is the position of
+// the work, nil when it is not in the source
+func (b *AssignmentGraphBuilder) limitReached(node *sitter.Node) bool {
+	if b.truncated != nil {
+		return true
+	}
+
+	switch {
+	case (b.limits.maxNodes > 0) && (b.nodes >= b.limits.maxNodes):
+		b.truncate(limitNodes, node, "Visited %d syntax tree nodes", b.nodes)
+	case (b.limits.maxDefinitions > 0) && (len(b.definitionsRegistry) >= b.limits.maxDefinitions):
+		b.truncate(limitDefinitions, node, "Created %d definitions", len(b.definitionsRegistry))
+	case b.ctx.Err() != nil:
+		b.truncate(limitTimeout, node, "Analysis took longer than %s", b.limits.timeout)
+	}
+
+	return b.truncated != nil
+}
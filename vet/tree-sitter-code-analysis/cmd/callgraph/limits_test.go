@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalysisLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits analysisLimits
+		limit  string
+	}{
+		{"no limits", analysisLimits{}, ""},
+		{"default limits", defaultAnalysisLimits, ""},
+		{"file size", analysisLimits{maxFileSize: 100}, limitFileSize},
+		{"syntax tree nodes", analysisLimits{maxNodes: 50}, limitNodes},
+		{"definitions", analysisLimits{maxDefinitions: 10}, limitDefinitions},
+		{"timeout", analysisLimits{timeout: time.Nanosecond}, limitTimeout},
+	}
+
+	path := filepath.Join("..", "..", "samples", "4.py")
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			builder, diagnostics, err := analyzeFile("samples.4", path, analysisOptions{limits: test.limits})
+			if err != nil {
+				t.Fatalf("analyzing %s: %v", path, err)
+			}
+
+			if test.limit == "" {
+				if builder.truncated != nil {
+					t.Errorf("unexpected truncation: %v", builder.truncated)
+				}
+
+				return
+			}
+
+			if (builder.truncated == nil) || (builder.truncated.Limit != test.limit) {
+				t.Fatalf("expected truncation by %s, got %v", test.limit, builder.truncated)
+			}
+
+			marked := false
+			for _, d := range diagnostics {
+				marked = marked || strings.HasPrefix(d.Message, "Analysis truncated by the "+test.limit+" limit")
+			}
+
+			if !marked {
+				t.Errorf("expected a truncation diagnostic, got %v", diagnostics)
+			}
+
+			// Results before the limit are kept
+			if (test.limit != limitTimeout) && (len(builder.definitionsRegistry) < 2) {
+				t.Errorf("expected partial results, got %d definitions", len(builder.definitionsRegistry))
+			}
+		})
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.py")
+	if err := os.WriteFile(path, []byte("a = 1\nb = 2\nc = 3\n"), 0644); err != nil {
+		t.Fatalf("writing source: %v", err)
+	}
+
+	cases := []struct {
+		maxFileSize int64
+		expected    string
+		cut         bool
+	}{
+		{0, "a = 1\nb = 2\nc = 3\n", false},
+		{18, "a = 1\nb = 2\nc = 3\n", false},
+		{15, "a = 1\nb = 2\n", true},
+		{3, "a =", true},
+	}
+
+	for _, test := range cases {
+		data, cut, err := readSource(path, analysisLimits{maxFileSize: test.maxFileSize})
+		if err != nil {
+			t.Fatalf("reading source: %v", err)
+		}
+
+		if (string(data) != test.expected) || (cut != test.cut) {
+			t.Errorf("readSource with limit %d = %q, %v, expected %q, %v",
+				test.maxFileSize, data, cut, test.expected, test.cut)
+		}
+	}
+}
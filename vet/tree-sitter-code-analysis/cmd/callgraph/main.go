@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,14 @@ import (
 	"github.com/smacker/go-tree-sitter/python"
 )
 
+// Trace of the analysis for debugging. Commands producing structured
+// output discard it
+var traceOutput io.Writer = os.Stdout
+
+func tracef(format string, args ...any) {
+	fmt.Fprintf(traceOutput, format, args...)
+}
+
 type idType string
 
 var (
@@ -23,6 +32,10 @@ var (
 
 	idTypeLiteral idType = "literal"
 	idTypeUnknown idType = "unknown"
+
+	// A symbolic reference to a (possibly external) dotted name,
+	// produced by dynamic lookups such as getattr(..)
+	idTypeReference idType = "reference"
 )
 
 type definition struct {
@@ -116,6 +129,20 @@ func (s *scope) newScope(owner *definition) *scope {
 	return newScope(s, owner)
 }
 
+// Find a definition by name in this scope only. When multiple definitions
+// share a name, the one with the lowest id wins to keep the analysis
+// deterministic
+func (s *scope) lookup(name string) (*definition, bool) {
+	var found *definition
+	for id, def := range s.defs {
+		if (def.name == name) && ((found == nil) || (id < found.id())) {
+			found = def
+		}
+	}
+
+	return found, found != nil
+}
+
 type AssignmentGraph struct {
 	// Map of objects to an element to an element of the power set of objects
 	edges map[string]map[string]bool
@@ -137,17 +164,97 @@ type AssignmentGraphBuilder struct {
 	// assignment relationship between them
 	assignmentGraph map[string][]string
 
+	// Folded constant values of definitions, used to resolve dynamic
+	// lookups such as getattr(mod, "sys" + "tem")
+	constants map[string]string
+
+	// Call graph holding caller to callee mapping. Unresolved callees
+	// are recorded by their dotted name
+	callGraph map[string][]string
+
+	// Dynamic constructs that could not be resolved statically
+	obfuscationIndicators []obfuscationIndicator
+
+	// Syntax errors and malformed nodes skipped during the visit
+	diagnostics []diagnostic
+
+	// Calls through variables, resolved after the visit
+	receiverCalls []*receiverCall
+
+	// Objects (classes and functions) each variable may refer to
+	pointsTo map[string][]string
+
+	// Parameter definitions of each function, in declaration order
+	parameters map[string][]string
+
+	// Length of call strings distinguishing function contexts. When zero,
+	// all calls to a function share its parameter and __ret definitions
+	contextDepth int
+
+	// Calls to functions, cloned per context after the visit when the
+	// analysis is context sensitive
+	callSites []*callSite
+
+	// Call graph between functions qualified by their context
+	contextCallGraph map[string][]string
+
+	// Clones of each definition, one per context of its function
+	contextClones map[string][]string
+
+	// Source lines of the calls behind each call graph edge
+	callLines map[string][]uint32
+
+	// Line of the call being visited
+	callLine uint32
+
+	// Literals that look like encoded payloads
+	payloads []*encodedPayload
+
+	// Decode payloads recursively when recording them
+	decodePayloads bool
+
+	// Calls to callees outside the module and their arguments
+	externalCalls []externalCall
+
+	// Values of calls used as receivers, as in f().decode(), by call site
+	callReceivers map[string]*definition
+
+	// Limits of the analysis, checked against the context and counters
+	limits analysisLimits
+	ctx    context.Context
+	nodes  int
+
+	// The limit that stopped the analysis, nil when complete
+	truncated *truncation
+
+	// Syntax tree and source of the module, read again by detectors after
+	// the analysis. Nil when the file could not be parsed
+	tree   *sitter.Tree
+	source []byte
+
 	// The current namespace
 	currentNamespace *namespace
 }
 
 func newAssignmentGraphBuilder(ns *namespace) *AssignmentGraphBuilder {
 	return &AssignmentGraphBuilder{
-		definitionsRegistry: make(map[string]*definition),
-		classHierarchy:      make(map[string][]string),
-		assignmentGraph:     make(map[string][]string),
-		scope:               newScope(nil, nil),
-		currentNamespace:    ns,
+		definitionsRegistry:   make(map[string]*definition),
+		classHierarchy:        make(map[string][]string),
+		assignmentGraph:       make(map[string][]string),
+		constants:             make(map[string]string),
+		callGraph:             make(map[string][]string),
+		obfuscationIndicators: make([]obfuscationIndicator, 0),
+		diagnostics:           make([]diagnostic, 0),
+		pointsTo:              make(map[string][]string),
+		parameters:            make(map[string][]string),
+		contextCallGraph:      make(map[string][]string),
+		contextClones:         make(map[string][]string),
+		callLines:             make(map[string][]uint32),
+		callReceivers:         make(map[string]*definition),
+		payloads:              make([]*encodedPayload, 0),
+		ctx:                   context.Background(),
+		scope:                 newScope(nil, nil),
+		currentNamespace:      ns,
 	}
 }
 
@@ -199,18 +306,50 @@ func (b *AssignmentGraphBuilder) assignmentEdge(from, to *definition) {
 		b.assignmentGraph[from.id()] = make([]string, 0)
 	}
 
+	// The targets form a set
+	for _, id := range b.assignmentGraph[from.id()] {
+		if id == to.id() {
+			return
+		}
+	}
+
 	b.assignmentGraph[from.id()] = append(b.assignmentGraph[from.id()], to.id())
 }
 
+func (b *AssignmentGraphBuilder) removeAssignmentEdge(from, to string) {
+	targets := b.assignmentGraph[from]
+	for i, id := range targets {
+		if id == to {
+			b.assignmentGraph[from] = append(targets[:i:i], targets[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *AssignmentGraphBuilder) callEdge(callee string) {
+	b.callEdgeFrom(b.currentNamespace.definition.id(), callee, b.callLine)
+}
+
+func (b *AssignmentGraphBuilder) callEdgeFrom(caller, callee string, line uint32) {
+	b.callGraph[caller] = append(b.callGraph[caller], callee)
+
+	if line > 0 {
+		key := callLinesKey(caller, callee)
+		b.callLines[key] = append(b.callLines[key], line)
+	}
+}
+
+func callLinesKey(caller, callee string) string {
+	return caller + " -> " + callee
+}
+
 // Find in scope by name (binding)
 func (b *AssignmentGraphBuilder) findInScope(name string) (*definition, bool) {
 	for scope := b.scope; scope != nil; scope = scope.parent {
-		fmt.Printf("Searching for %s in scope: %s\n", name, b.scope.id())
+		tracef("Searching for %s in scope: %s\n", name, b.scope.id())
 
-		for _, def := range scope.defs {
-			if def.name == name {
-				return def, true
-			}
+		if def, ok := scope.lookup(name); ok {
+			return def, true
 		}
 	}
 
@@ -233,9 +372,7 @@ func (b *AssignmentGraphBuilder) findAttributedNameInScope(name string) (*defini
 	}
 
 	for _, attr := range attributes[1:] {
-		fmt.Printf("Searching for %s in %s\n", attr, def.id())
-
-		found := false
+		tracef("Searching for %s in %s\n", attr, def.id())
 
 		scope := def.scope
 		if scope == nil {
@@ -246,14 +383,7 @@ func (b *AssignmentGraphBuilder) findAttributedNameInScope(name string) (*defini
 			return nil, false
 		}
 
-		for _, childDef := range scope.defs {
-			if childDef.name == attr {
-				def = childDef
-				found = true
-			}
-		}
-
-		if !found {
+		if def, ok = scope.lookup(attr); !ok {
 			return nil, false
 		}
 	}
@@ -279,7 +409,7 @@ func (b *AssignmentGraphBuilder) visitClassDefinition(v *Visitor, node *sitter.N
 		if superclasses.Child(0).Type() == "(" {
 			// Handle grouping, skip the ( and ) nodes
 			for i := 1; i < int(superclasses.ChildCount()-1); i++ {
-				superClassDef := b.newDefinition(idTypeClass, v.val(superclasses.Child(i)))
+				superClassDef := b.superClassDefinition(v, superclasses.Child(i))
 				b.classHierarchy[classDef.id()] = append(b.classHierarchy[classDef.id()], superClassDef.id())
 
 				// Skip the "," node
@@ -287,7 +417,7 @@ func (b *AssignmentGraphBuilder) visitClassDefinition(v *Visitor, node *sitter.N
 			}
 		} else {
 			// Handle single superclass
-			superClassDef := b.newDefinition(idTypeClass, v.val(superclasses.Child(0)))
+			superClassDef := b.superClassDefinition(v, superclasses.Child(0))
 			b.classHierarchy[classDef.id()] = append(b.classHierarchy[classDef.id()], superClassDef.id())
 		}
 	}
@@ -297,11 +427,21 @@ func (b *AssignmentGraphBuilder) visitClassDefinition(v *Visitor, node *sitter.N
 		_, err = v.visit(body)
 	})
 
-	fmt.Printf("Class: %s defined in scope: %s\n", classDef.name, b.scope.id())
+	tracef("Class: %s defined in scope: %s\n", classDef.name, b.scope.id())
 
 	return classDef, err
 }
 
+// Resolve a superclass in scope. Classes not defined in the module are
+// created without a scope
+func (b *AssignmentGraphBuilder) superClassDefinition(v *Visitor, node *sitter.Node) *definition {
+	if def, ok := b.findAttributedNameInScope(v.val(node)); ok && (def.idType == idTypeClass) {
+		return def
+	}
+
+	return b.newDefinition(idTypeClass, v.val(node))
+}
+
 func (b *AssignmentGraphBuilder) visitFunctionDefinition(v *Visitor, node *sitter.Node) (*definition, error) {
 	name := node.ChildByFieldName("name")
 	body := node.ChildByFieldName("body")
@@ -313,13 +453,36 @@ func (b *AssignmentGraphBuilder) visitFunctionDefinition(v *Visitor, node *sitte
 	var err error
 	funcDef := b.newDefinition(idTypeFunction, v.val(name))
 
+	// Methods receive an instance of the class as first parameter
+	var receiverClass *definition
+	if (b.scope.owner != nil) && (b.scope.owner.idType == idTypeClass) {
+		receiverClass = b.scope.owner
+	}
+
+	b.parameters[funcDef.id()] = nil
+
 	b.newScope(funcDef, func() {
+		// Return node merging every return and yield of the function
+		b.newDefinition(idTypeVariable, "__ret")
+
 		params := node.ChildByFieldName("parameters")
 		if params != nil {
 			// Params are a group, surrounded by ( and )
 			for i := 1; i < int(params.ChildCount()-1); i++ {
+				paramName, ok := v.parameterName(params.Child(i))
+				if !ok {
+					// Skip the "," node
+					i++
+					continue
+				}
+
 				// Bind the param to the function scope
-				b.newDefinition(idTypeVariable, v.val(params.Child(i)))
+				paramDef := b.newDefinition(idTypeVariable, paramName)
+				if (i == 1) && (receiverClass != nil) {
+					b.assignmentEdge(paramDef, receiverClass)
+				}
+
+				b.parameters[funcDef.id()] = append(b.parameters[funcDef.id()], paramDef.id())
 
 				// Skip the "," node
 				i++
@@ -333,7 +496,12 @@ func (b *AssignmentGraphBuilder) visitFunctionDefinition(v *Visitor, node *sitte
 }
 
 func (b *AssignmentGraphBuilder) visitReturnStatement(v *Visitor, node *sitter.Node) (*definition, error) {
-	fmt.Printf("Visiting return statement with child count: %d\n", node.ChildCount())
+	tracef("Visiting return statement with child count: %d\n", node.ChildCount())
+
+	retDef, ok := b.enclosingReturn()
+	if !ok {
+		return nil, fmt.Errorf("Return outside function")
+	}
 
 	// https://github.com/tree-sitter/tree-sitter-python/blob/master/grammar.js#L235
 	if node.ChildCount() > 1 {
@@ -344,13 +512,95 @@ func (b *AssignmentGraphBuilder) visitReturnStatement(v *Visitor, node *sitter.N
 			return nil, err
 		}
 
-		retDef := b.newDefinition(idTypeVariable, "__ret")
 		b.assignmentEdge(retDef, exprDef)
+	}
 
-		return retDef, nil
+	return retDef, nil
+}
+
+// Values produced by a generator flow into its return node, so callers
+// iterating over the generator see them. The value of yield from is the
+// return value of the delegate, which is merged into the same node
+func (b *AssignmentGraphBuilder) visitYield(v *Visitor, node *sitter.Node) (*definition, error) {
+	retDef, ok := b.enclosingReturn()
+	if !ok {
+		return nil, fmt.Errorf("Yield outside function")
 	}
 
-	return b.newDefinition(idTypeUnknown, "nil_return"), nil
+	delegate := false
+	for i := 1; i < int(node.ChildCount()); i++ {
+		child := node.Child(i)
+		if child.Type() == "from" {
+			delegate = true
+			continue
+		}
+
+		exprDef, err := b.eval(v, child)
+		if err != nil {
+			return nil, err
+		}
+
+		b.assignmentEdge(retDef, exprDef)
+
+		if delegate {
+			return exprDef, nil
+		}
+	}
+
+	// Values sent into the generator are not tracked
+	return b.newDefinition(idTypeUnknown, "__yield_sent"), nil
+}
+
+// Loop targets are bound to the iterable, elements of containers and
+// values of generators are not distinguished from the container
+func (b *AssignmentGraphBuilder) visitForStatement(v *Visitor, node *sitter.Node) (*definition, error) {
+	left := node.ChildByFieldName("left")
+	right := node.ChildByFieldName("right")
+	body := node.ChildByFieldName("body")
+
+	if (left == nil) || (right == nil) || (body == nil) {
+		return nil, fmt.Errorf("Invalid for statement")
+	}
+
+	rightDef, err := b.eval(v, right)
+	if err != nil {
+		return nil, err
+	}
+
+	leftDef, err := b.eval(v, left)
+	if err != nil {
+		return nil, err
+	}
+
+	b.assignmentEdge(leftDef, rightDef)
+
+	if _, err := v.visit(body); err != nil {
+		return nil, err
+	}
+
+	if alternative := node.ChildByFieldName("alternative"); alternative != nil {
+		if _, err := v.visit(alternative); err != nil {
+			return nil, err
+		}
+	}
+
+	return leftDef, nil
+}
+
+// The return node of the function whose body is being visited. Returns
+// of nested functions and enclosing functions are kept apart
+func (b *AssignmentGraphBuilder) enclosingReturn() (*definition, bool) {
+	for scope := b.scope; scope != nil; scope = scope.parent {
+		if scope.owner == nil || scope.owner.idType == idTypeClass {
+			break
+		}
+
+		if scope.owner.idType == idTypeFunction {
+			return scope.lookup("__ret")
+		}
+	}
+
+	return nil, false
 }
 
 func (b *AssignmentGraphBuilder) visitCall(v *Visitor, node *sitter.Node) (*definition, error) {
@@ -359,66 +609,126 @@ func (b *AssignmentGraphBuilder) visitCall(v *Visitor, node *sitter.Node) (*defi
 		return nil, fmt.Errorf("Invalid call")
 	}
 
-	calleeName := v.val(name)
+	calleeName, err := b.resolveName(v, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calls nested in the arguments have their own line
+	line := b.callLine
+	b.callLine = node.StartPoint().Row + 1
+	defer func() { b.callLine = line }()
 
-	fmt.Printf("%s -> %s@%s\n", b.currentNamespace.id(),
+	tracef("%s -> %s@%s\n", b.currentNamespace.id(),
 		b.scope.id(),
 		calleeName)
 
-	// Lookup callee in scope
-	if calleeDef, ok := b.findAttributedNameInScope(calleeName); ok {
+	// Lookup callee in scope. Callees bound to variables are resolved
+	// after the visit using points-to sets
+	if calleeDef, ok := b.findAttributedNameInScope(calleeName); ok && (calleeDef.idType != idTypeVariable) {
 		var retDef *definition = b.newDefinition(idTypeUnknown, fmt.Sprintf("__call_%s_ret", calleeName))
 
-		fmt.Printf("Found callee: %s\n", calleeDef.id())
+		tracef("Found callee: %s\n", calleeDef.id())
+		b.callEdge(calleeDef.id())
 
 		// If the callee is a class constructor, we need to resolve the
 		// __init__ method
-		if calleeDef.idType == idTypeClass {
-			fmt.Printf("Callee is a class constructor\n")
+		constructor := calleeDef.idType == idTypeClass
+		if constructor {
+			tracef("Callee is a class constructor\n")
+
+			// The instance created by the constructor points to the class
+			classDef := calleeDef
+			retDef = b.newDefinition(idTypeUnknown, fmt.Sprintf("__class_init_%s", calleeName))
+			b.assignmentEdge(retDef, classDef)
 
 			// TODO: Resolve __init__ method in class hierarchy
 
-			b.switchScope(calleeDef.scope, func() {
-				if initDef, ok := b.findInScope("__init__"); ok {
-					calleeDef = initDef
-					retDef = initDef
-				} else {
-					calleeDef = b.newDefinition(idTypeUnknown, fmt.Sprintf("__class_init_%s", calleeName))
-					retDef = calleeDef
-				}
-			})
+			// Classes defined outside the module have no scope
+			if classDef.scope != nil {
+				b.switchScope(classDef.scope, func() {
+					if initDef, ok := b.findInScope("__init__"); ok {
+						calleeDef = initDef
+					}
+				})
+			}
 		}
 
-		args := node.ChildByFieldName("arguments")
-		if (args != nil) && (args.ChildCount() > 0) {
-			// Check if args is of type argument_list
-			if args.Child(0).Type() == "argument_list" {
-				// Skip the ( and ) nodes
-				for i := 1; i < int(args.ChildCount()-1); i++ {
-					arg := args.Child(i)
-					argDef, err := b.eval(v, arg)
-					if err != nil {
-						return nil, err
-					}
+		args, err := b.evalArguments(v, node)
+		if err != nil {
+			return nil, err
+		}
 
-					b.assignmentEdge(calleeDef, argDef)
+		for _, arg := range args {
+			b.assignmentEdge(calleeDef, b.definitionsRegistry[arg.def])
+		}
 
-					// Skip the "," node
-					i++
-				}
+		site := b.newCallSite(node, calleeDef, args)
+
+		// Constructors return the instance, __init__ receives it as self
+		if constructor {
+			if calleeDef.idType == idTypeFunction {
+				site.offset = 1
+				b.recordCallSite(site)
 			}
+
+			return retDef, nil
 		}
 
-		b.switchScope(calleeDef.scope, func() {
-			if r, ok := b.findInScope("__ret"); ok {
-				retDef = r
+		// Every call site has its own return value when contexts are cloned
+		if b.contextDepth > 0 {
+			retDef = b.newDefinition(idTypeUnknown, fmt.Sprintf("__call_%s_ret@%s", calleeName, site.id))
+			site.ret = retDef.id()
+			b.recordCallSite(site)
+
+			return retDef, nil
+		}
+
+		b.recordCallSite(site)
+
+		// Callees without a scope, such as imported names, return an
+		// unknown value
+		if calleeDef.scope != nil {
+			if ret, ok := calleeDef.scope.lookup("__ret"); ok {
+				retDef = ret
 			}
-		})
+		}
 
 		return retDef, nil
 	}
 
-	return b.newDefinition(idTypeUnknown, fmt.Sprintf("__call_%s", calleeName)), nil
+	if def, ok, err := b.visitEventLoopCall(v, node, calleeName); ok {
+		return def, err
+	}
+
+	if def, ok, err := b.visitReceiverCall(v, node, calleeName); ok {
+		return def, err
+	}
+
+	b.callEdge(calleeName)
+
+	if def, ok, err := b.visitDynamicCall(v, node, calleeName); ok {
+		return def, err
+	}
+
+	args, err := b.evalArguments(v, node)
+	if err != nil {
+		return nil, err
+	}
+
+	// Methods called on the value of another call receive that value
+	receiver := ""
+	if object := name.ChildByFieldName("object"); (name.Type() == "attribute") && (object != nil) {
+		if def, ok := b.callReceivers[callSiteId(object)]; ok {
+			receiver = def.id()
+		}
+	}
+
+	retDef := b.newDefinition(idTypeUnknown, callReturnName(node, calleeName))
+	b.externalCall(node, calleeName, args)
+	b.decoderEdges(calleeName, retDef, receiver, args)
+
+	return retDef, nil
 }
 
 func (b *AssignmentGraphBuilder) visitAssignment(v *Visitor, node *sitter.Node) (*definition, error) {
@@ -439,7 +749,7 @@ func (b *AssignmentGraphBuilder) visitAssignment(v *Visitor, node *sitter.Node)
 		return nil, err
 	}
 
-	fmt.Printf("left: %v right: %v\n", leftDef, rightDef)
+	tracef("left: %v right: %v\n", leftDef, rightDef)
 
 	// Add assignment to graph
 	b.assignmentEdge(leftDef, rightDef)
@@ -448,7 +758,16 @@ func (b *AssignmentGraphBuilder) visitAssignment(v *Visitor, node *sitter.Node)
 }
 
 func (b *AssignmentGraphBuilder) visitLiteral(v *Visitor, node *sitter.Node) (*definition, error) {
-	return b.newDefinition(idTypeLiteral, v.val(node)), nil
+	def := b.newDefinition(idTypeLiteral, v.val(node))
+	if value, ok := v.literalValue(node); ok {
+		b.constants[def.id()] = value
+
+		if node.Type() == "string" {
+			b.payloadLiteral(node, def, value)
+		}
+	}
+
+	return def, nil
 }
 
 func (b *AssignmentGraphBuilder) visitExpressionStatement(v *Visitor, node *sitter.Node) (*definition, error) {
@@ -471,11 +790,20 @@ func (b *AssignmentGraphBuilder) visitExpressionStatement(v *Visitor, node *sitt
 
 func (b *AssignmentGraphBuilder) visitIdentifier(v *Visitor, node *sitter.Node) (*definition, error) {
 	name := v.val(node)
-	return b.newDefinition(idTypeVariable, name), nil
+	target, found := b.findInScope(name)
+
+	def := b.newDefinition(idTypeVariable, name)
+
+	// References to functions and classes flow through assignments
+	if found && ((target.idType == idTypeFunction) || (target.idType == idTypeClass)) {
+		b.assignmentEdge(def, target)
+	}
+
+	return def, nil
 }
 
 func (b *AssignmentGraphBuilder) visitAttributeExpression(_ *Visitor, _ *sitter.Node) (*definition, error) {
-	fmt.Printf("Visiting attribute expression\n")
+	tracef("Visiting attribute expression\n")
 	return b.newDefinition(idTypeUnknown, "attribute"), nil
 }
 
@@ -507,12 +835,23 @@ func (b *AssignmentGraphBuilder) visitModule(v *Visitor, node *sitter.Node) (*de
 }
 
 type Visitor struct {
+	file    string
 	data    []byte
 	builder *AssignmentGraphBuilder
+
+	// Nesting of the code strings passed to exec(..) being visited, zero
+	// for the source of the file
+	execDepth int
+
+	// Call passing the outermost code string being visited, nil for the
+	// source of the file. Positions in code strings are not positions in
+	// the file, diagnostics are reported at the call instead
+	execCall *sitter.Node
 }
 
-func newVisitor(data []byte, builder *AssignmentGraphBuilder) *Visitor {
+func newVisitor(file string, data []byte, builder *AssignmentGraphBuilder) *Visitor {
 	return &Visitor{
+		file:    file,
 		data:    data,
 		builder: builder,
 	}
@@ -525,9 +864,33 @@ func (v *Visitor) val(node *sitter.Node) string {
 	return string(v.data[start:end])
 }
 
+// Visit a node, skipping subtrees that could not be parsed. A malformed
+// node is recorded as a diagnostic instead of failing the whole module
+func (v *Visitor) visit(node *sitter.Node) (*definition, error) {
+	// Syntax errors are reported by collectSyntaxDiagnostics
+	if node.IsError() || node.IsMissing() {
+		return v.builder.newDefinition(idTypeUnknown, "syntax_error"), nil
+	}
+
+	// Past a limit the rest of the tree is skipped
+	if v.builder.limitReached(node) {
+		return v.builder.newDefinition(idTypeUnknown, "truncated"), nil
+	}
+
+	v.builder.nodes++
+
+	def, err := v.visitNode(node)
+	if err != nil {
+		v.diagnostic(node, err.Error())
+		return v.builder.newDefinition(idTypeUnknown, node.Type()), nil
+	}
+
+	return def, nil
+}
+
 // Tree Sitter python grammar
 // https://github.com/tree-sitter/tree-sitter-python/blob/master/grammar.js
-func (v *Visitor) visit(node *sitter.Node) (*definition, error) {
+func (v *Visitor) visitNode(node *sitter.Node) (*definition, error) {
 	switch node.Type() {
 	case "class_definition":
 		return v.builder.visitClassDefinition(v, node)
@@ -543,16 +906,28 @@ func (v *Visitor) visit(node *sitter.Node) (*definition, error) {
 		return v.builder.visitExpressionStatement(v, node)
 	case "number", "integer", "string", "boolean":
 		return v.builder.visitLiteral(v, node)
+	case "concatenated_string":
+		return v.builder.visitConcatenatedString(v, node)
+	case "binary_operator":
+		return v.builder.visitBinaryOperator(v, node)
 	case "attribute":
 		return v.builder.visitAttributeExpression(v, node)
 	case "return_statement":
 		return v.builder.visitReturnStatement(v, node)
+	case "yield":
+		return v.builder.visitYield(v, node)
+	case "for_statement":
+		return v.builder.visitForStatement(v, node)
+	case "with_statement":
+		return v.builder.visitWithStatement(v, node)
+	case "await":
+		return v.builder.visitAwait(v, node)
 	case "module":
 		return v.builder.visitModule(v, node)
 	case "list":
 		return v.builder.visitList(v, node)
 	default:
-		fmt.Printf("Visiting node: %s\n", node.Type())
+		tracef("Visiting node: %s\n", node.Type())
 
 		var err error
 		var def *definition = v.builder.newDefinition(idTypeUnknown, node.Type())
@@ -580,53 +955,142 @@ func fileToModuleName(file string) string {
 	return name
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <file.py>\n", os.Args[0])
-		os.Exit(1)
+// Load a module into the builder. Syntax errors and malformed nodes
+// do not stop the analysis, they are returned as diagnostics
+func loadModule(parser *sitter.Parser, path string, builder *AssignmentGraphBuilder) ([]diagnostic, error) {
+	start := len(builder.diagnostics)
+
+	fileContent, cut, err := readSource(path, builder.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if cut {
+		builder.truncate(limitFileSize, nil, "File is larger than %d bytes, analyzed the first %d",
+			builder.limits.maxFileSize, len(fileContent))
+	}
+
+	cst, err := parser.ParseCtx(builder.ctx, nil, fileContent)
+	if (err != nil) && (builder.ctx.Err() != nil) {
+		builder.truncate(limitTimeout, nil, "Parsing took longer than %s", builder.limits.timeout)
+		return builder.diagnostics[start:], nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cst.RootNode() == nil {
+		return nil, fmt.Errorf("Error parsing file: root node is nil")
+	}
+
+	builder.tree = cst
+	builder.source = fileContent
+
+	visitor := newVisitor(path, fileContent, builder)
+
+	visitor.collectSyntaxDiagnostics(cst.RootNode())
+
+	_, err = visitor.visit(cst.RootNode())
+	if err != nil {
+		return nil, err
 	}
 
+	return builder.diagnostics[start:], nil
+}
+
+// Options of the analysis
+type analysisOptions struct {
+	// Call site sensitivity (k) of the analysis, zero to merge all
+	// calls to a function
+	contextDepth int
+
+	// Decode the layers of encoded payloads
+	decodePayloads bool
+
+	limits analysisLimits
+}
+
+// Analyze a Python file as the named module
+func analyzeFile(module, path string, options analysisOptions) (*AssignmentGraphBuilder, []diagnostic, error) {
 	parser := sitter.NewParser()
 	parser.SetLanguage(python.GetLanguage())
 
-	programDef := newDefinition(nil, idTypeModule, fileToModuleName(os.Args[1]))
+	programDef := newDefinition(nil, idTypeModule, module)
 	programNs := newNamespace(programDef, nil, nil)
 
 	builder := newAssignmentGraphBuilder(programNs)
+	builder.definitionsRegistry[programDef.id()] = programDef
+	builder.contextDepth = options.contextDepth
+	builder.decodePayloads = options.decodePayloads
+	builder.limits = options.limits
 
-	loadModule := func(path string, builder *AssignmentGraphBuilder) error {
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
+	ctx, cancel := options.limits.context()
+	defer cancel()
 
-		defer file.Close()
+	builder.ctx = ctx
 
-		fileContent, err := io.ReadAll(file)
-		if err != nil {
-			return err
-		}
+	diagnostics, err := loadModule(parser, path, builder)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		cst, err := parser.ParseCtx(context.Background(), nil, fileContent)
-		if err != nil {
-			return err
-		}
+	builder.resolveReceiverCalls()
+	builder.tracePayloads()
 
-		if cst.RootNode() == nil {
-			return fmt.Errorf("Error parsing file: root node is nil")
+	// Results are partial, the marker is reported with the diagnostics
+	if t := builder.truncated; t != nil {
+		d := diagnostic{
+			File:    path,
+			Line:    t.Line,
+			Column:  t.Column,
+			Message: fmt.Sprintf("Analysis truncated by the %s limit: %s", t.Limit, t.Message),
 		}
 
-		visitor := newVisitor(fileContent, builder)
+		builder.diagnostics = append(builder.diagnostics, d)
+		diagnostics = append(diagnostics, d)
+	}
 
-		_, err = visitor.visit(cst.RootNode())
-		if err != nil {
-			return err
+	return builder, diagnostics, nil
+}
+
+// Commands other than the default graph output, selected by the
+// first argument
+var commands = map[string]func(args []string) error{
+	"query":       queryCommand,
+	"export":      exportCommand,
+	"entrypoints": entryPointsCommand,
+	"installtime": installTimeCommand,
+	"metrics":     metricsCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [query|export|entrypoints|installtime|metrics] [-k <depth>] [-decode] [-max-file-size <bytes>] [-max-nodes <n>] [-max-definitions <n>] [-timeout <duration>] <file.py>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	if command, ok := commands[os.Args[1]]; ok {
+		if err := command(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
 		}
 
-		return nil
+		return
 	}
 
-	err := loadModule(os.Args[1], builder)
+	var options analysisOptions
+	flag.IntVar(&options.contextDepth, "k", 0, "Call site sensitivity, clones functions per call context when > 0")
+	flag.BoolVar(&options.decodePayloads, "decode", false, "Decode encoded payloads recursively")
+	options.limits.registerFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [query|export|entrypoints|installtime|metrics] [-k <depth>] [-decode] [-max-file-size <bytes>] [-max-nodes <n>] [-max-definitions <n>] [-timeout <duration>] <file.py>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(flag.Arg(0)), flag.Arg(0), options)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading module: %s\n", err)
 		os.Exit(1)
@@ -640,4 +1104,69 @@ func main() {
 	} else {
 		fmt.Println(string(jsonGraph))
 	}
+
+	fmt.Printf("Call Graph:\n")
+
+	jsonGraph, err = json.MarshalIndent(builder.callGraph, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling call graph: %s\n", err)
+	} else {
+		fmt.Println(string(jsonGraph))
+	}
+
+	if options.contextDepth > 0 {
+		fmt.Printf("Context Call Graph:\n")
+
+		jsonGraph, err = json.MarshalIndent(builder.contextCallGraph, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshalling context call graph: %s\n", err)
+		} else {
+			fmt.Println(string(jsonGraph))
+		}
+	}
+
+	fmt.Printf("Points-To:\n")
+
+	jsonGraph, err = json.MarshalIndent(builder.pointsTo, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling points-to sets: %s\n", err)
+	} else {
+		fmt.Println(string(jsonGraph))
+	}
+
+	fmt.Printf("Diagnostics:\n")
+
+	jsonDiagnostics, err := json.MarshalIndent(diagnostics, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling diagnostics: %s\n", err)
+	} else {
+		fmt.Println(string(jsonDiagnostics))
+	}
+
+	fmt.Printf("Truncated:\n")
+
+	jsonTruncated, err := json.MarshalIndent(builder.truncated, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling truncation: %s\n", err)
+	} else {
+		fmt.Println(string(jsonTruncated))
+	}
+
+	fmt.Printf("Obfuscation Indicators:\n")
+
+	jsonIndicators, err := json.MarshalIndent(builder.obfuscationIndicators, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling obfuscation indicators: %s\n", err)
+	} else {
+		fmt.Println(string(jsonIndicators))
+	}
+
+	fmt.Printf("Encoded Payloads:\n")
+
+	jsonPayloads, err := json.MarshalIndent(builder.payloads, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling encoded payloads: %s\n", err)
+	} else {
+		fmt.Println(string(jsonPayloads))
+	}
 }
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+func TestMain(m *testing.M) {
+	// The trace of the analysis is too noisy for test output
+	traceOutput = io.Discard
+
+	os.Exit(m.Run())
+}
+
+// Graphs compared against the golden files
+type goldenGraphs struct {
+	AssignmentGraph map[string][]string `json:"assignmentGraph"`
+	CallGraph       map[string][]string `json:"callGraph"`
+}
+
+func TestSamplesGolden(t *testing.T) {
+	cases := []struct {
+		name   string
+		sample string
+	}{
+		{
+			"direct function calls",
+			"1.py",
+		},
+		{
+			"class hierarchy",
+			"2.py",
+		},
+		{
+			"function arguments",
+			"3.py",
+		},
+		{
+			"nested classes and receivers",
+			"4.py",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			module := fileToModuleName(filepath.Join("samples", test.sample))
+			path := filepath.Join("..", "..", "samples", test.sample)
+
+			builder, diagnostics, err := analyzeFile(module, path, analysisOptions{})
+			if err != nil {
+				t.Fatalf("analyzing %s: %v", path, err)
+			}
+
+			if len(diagnostics) > 0 {
+				t.Errorf("unexpected diagnostics: %v", diagnostics)
+			}
+
+			actual, err := json.MarshalIndent(goldenGraphs{
+				AssignmentGraph: builder.assignmentGraph,
+				CallGraph:       builder.callGraph,
+			}, "", "  ")
+			if err != nil {
+				t.Fatalf("marshalling graphs: %v", err)
+			}
+
+			actual = append(actual, '\n')
+
+			golden := filepath.Join("testdata", strings.TrimSuffix(test.sample, ".py")+".golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatalf("updating golden file: %v", err)
+				}
+
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file (run go test -update to create): %v", err)
+			}
+
+			if string(expected) != string(actual) {
+				t.Errorf("graphs do not match %s (run go test -update to accept)\nexpected:\n%s\nactual:\n%s",
+					golden, expected, actual)
+			}
+		})
+	}
+}
+
+func TestScopeLookup(t *testing.T) {
+	s := newScope(nil, nil)
+	for _, idType := range []idType{idTypeVariable, idTypeFunction, idTypeClass} {
+		def := newDefinition(nil, idType, "f")
+		s.defs[def.id()] = def
+	}
+
+	// Definitions sharing a name resolve to the lowest id, whatever the
+	// order of the map
+	for i := 0; i < 10; i++ {
+		def, ok := s.lookup("f")
+		if !ok || (def.id() != "f[class]") {
+			t.Fatalf("expected f[class], got %v", def)
+		}
+	}
+
+	if _, ok := s.lookup("g"); ok {
+		t.Errorf("unexpected definition of g")
+	}
+}
+
+func TestClasses(t *testing.T) {
+	path := filepath.Join("testdata", "classes.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	// A superclass resolves to the class defined in the module
+	supers := builder.classHierarchy["testdata.classes/Child[class]"]
+	if actual := strings.Join(supers, ","); actual != "testdata.classes/Base[class]" {
+		t.Errorf("superclasses of Child: expected testdata.classes/Base[class], got %s", actual)
+	}
+
+	// Which keeps its scope, so that instantiating it still calls __init__
+	id := "testdata.classes/Base/__init__[function]"
+	if actual := strings.Join(builder.assignmentGraph[id], ","); actual != "testdata.classes/Value[variable]" {
+		t.Errorf("assignments of %s: expected testdata.classes/Value[variable], got %s", id, actual)
+	}
+
+	// Classes defined outside the module have no scope and no __init__
+	for variable, class := range map[string]string{"error": "Error", "failure": "Exception"} {
+		id := "testdata.classes/" + variable + "[variable]"
+		if actual := strings.Join(builder.pointsTo[id], ","); actual != "testdata.classes/"+class+"[class]" {
+			t.Errorf("points-to of %s: expected testdata.classes/%s[class], got %s", id, class, actual)
+		}
+	}
+}
+
+func TestContextSensitivity(t *testing.T) {
+	cases := []struct {
+		name     string
+		depth    int
+		variable string
+		objects  []string
+	}{
+		{
+			"insensitive merges calls",
+			0,
+			"testdata.contexts/a[variable]",
+			[]string{"testdata.contexts/A[class]", "testdata.contexts/B[class]"},
+		},
+		{
+			"one call site",
+			1,
+			"testdata.contexts/a[variable]",
+			[]string{"testdata.contexts/A[class]"},
+		},
+		{
+			"one call site through a wrapper",
+			1,
+			"testdata.contexts/c[variable]",
+			[]string{"testdata.contexts/A[class]", "testdata.contexts/B[class]"},
+		},
+		{
+			"two call sites through a wrapper",
+			2,
+			"testdata.contexts/c[variable]",
+			[]string{"testdata.contexts/A[class]"},
+		},
+		{
+			"two call sites through a wrapper, other argument",
+			2,
+			"testdata.contexts/d[variable]",
+			[]string{"testdata.contexts/B[class]"},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join("testdata", "contexts.py")
+
+			builder, _, err := analyzeFile(fileToModuleName(path), path, analysisOptions{contextDepth: test.depth})
+			if err != nil {
+				t.Fatalf("analyzing %s: %v", path, err)
+			}
+
+			actual := strings.Join(builder.pointsTo[test.variable], ",")
+			if expected := strings.Join(test.objects, ","); actual != expected {
+				t.Errorf("points-to of %s: expected %s, got %s", test.variable, expected, actual)
+			}
+		})
+	}
+}
+
+func TestReturnValues(t *testing.T) {
+	cases := []struct {
+		name     string
+		variable string
+		objects  []string
+	}{
+		{
+			"multiple returns are merged",
+			"testdata.returns/z[variable]",
+			[]string{"testdata.returns/A[class]", "testdata.returns/B[class]"},
+		},
+		{
+			"nested function does not return enclosing values",
+			"testdata.returns/outer/x[variable]",
+			nil,
+		},
+		{
+			"generator yields and delegates",
+			"testdata.returns/y[variable]",
+			[]string{"testdata.returns/A[class]", "testdata.returns/B[class]"},
+		},
+	}
+
+	path := filepath.Join("testdata", "returns.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := strings.Join(builder.pointsTo[test.variable], ",")
+			if expected := strings.Join(test.objects, ","); actual != expected {
+				t.Errorf("points-to of %s: expected %s, got %s", test.variable, expected, actual)
+			}
+		})
+	}
+}
+
+func TestAsync(t *testing.T) {
+	path := filepath.Join("testdata", "async.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	t.Run("await evaluates to the return value", func(t *testing.T) {
+		for _, variable := range []string{"main/x", "result", "task", "future"} {
+			id := "testdata.async/" + variable + "[variable]"
+			if actual := strings.Join(builder.pointsTo[id], ","); actual != "testdata.async/A[class]" {
+				t.Errorf("points-to of %s: expected testdata.async/A[class], got %s", id, actual)
+			}
+		}
+	})
+
+	t.Run("scheduled callables are called", func(t *testing.T) {
+		calls := strings.Join(builder.callGraph["testdata.async[module]"], ",")
+		for _, callee := range []string{"testdata.async/callback[function]", "testdata.async/compute[function]"} {
+			if !strings.Contains(calls, callee) {
+				t.Errorf("expected a call edge to %s, got %s", callee, calls)
+			}
+		}
+	})
+
+	t.Run("event loop methods need an event loop receiver", func(t *testing.T) {
+		calls := strings.Join(builder.callGraph["testdata.async[module]"], ",")
+		for _, callee := range []string{"asyncio.get_event_loop().call_soon",
+			"testdata.async/Scheduler/create_task[function]"} {
+			if !strings.Contains(calls, callee) {
+				t.Errorf("expected a call edge to %s, got %s", callee, calls)
+			}
+		}
+
+		if strings.Contains(calls, "scheduler.create_task") {
+			t.Errorf("unexpected event loop call on scheduler: %s", calls)
+		}
+
+		grouped := strings.Join(builder.callGraph["testdata.async/grouped[function]"], ",")
+		if !strings.Contains(grouped, "tg.create_task") {
+			t.Errorf("expected a call edge to tg.create_task, got %s", grouped)
+		}
+
+		id := "testdata.async/job[variable]"
+		if actual := strings.Join(builder.pointsTo[id], ","); actual != "testdata.async/A[class]" {
+			t.Errorf("points-to of %s: expected testdata.async/A[class], got %s", id, actual)
+		}
+	})
+}
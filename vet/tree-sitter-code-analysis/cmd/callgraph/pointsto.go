@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// A call through a variable, such as b.func() or f(), whose callees
+// depend on the objects the variable may refer to. These are resolved
+// after the visit, when the assignment graph is complete
+type receiverCall struct {
+	// Definition id of the calling namespace
+	caller string
+
+	// Callee name as written, recorded when nothing resolves
+	name string
+
+	// Definition id of the receiver variable
+	receiver string
+
+	// Attributes looked up on the objects the receiver points to
+	attributes []string
+
+	// Position of the call in the source
+	site string
+	line uint32
+
+	args []callArgument
+
+	// Definition id holding the return value of the call
+	ret string
+
+	// Callees resolved so far
+	callees map[string]bool
+}
+
+func (b *AssignmentGraphBuilder) visitReceiverCall(v *Visitor, node *sitter.Node,
+	calleeName string) (*definition, bool, error) {
+	attributes := strings.Split(calleeName, ".")
+
+	receiverDef, ok := b.findInScope(attributes[0])
+	if !ok || (receiverDef.idType != idTypeVariable) {
+		return nil, false, nil
+	}
+
+	call := &receiverCall{
+		caller:     b.currentNamespace.definition.id(),
+		site:       callSiteId(node),
+		line:       node.StartPoint().Row + 1,
+		name:       calleeName,
+		receiver:   receiverDef.id(),
+		attributes: attributes[1:],
+		callees:    make(map[string]bool),
+	}
+
+	args, err := b.evalArguments(v, node)
+	if err != nil {
+		return nil, true, err
+	}
+
+	call.args = args
+
+	// Every call site has its own return value when contexts are cloned
+	retName := callReturnName(node, calleeName)
+	if b.contextDepth > 0 {
+		retName = fmt.Sprintf("__call_%s@%s", calleeName, call.site)
+	}
+
+	retDef := b.newDefinition(idTypeUnknown, retName)
+	call.ret = retDef.id()
+	b.decoderEdges(calleeName, retDef, receiverDef.id(), args)
+
+	b.receiverCalls = append(b.receiverCalls, call)
+	return retDef, true, nil
+}
+
+// Compute flow insensitive points-to sets over the assignment graph. Classes
+// and functions are the objects, every definition points to the objects
+// reachable through assignment edges. Edges leaving objects model call
+// arguments and are not followed
+func (b *AssignmentGraphBuilder) computePointsTo() map[string]map[string]bool {
+	isObject := func(id string) bool {
+		def, ok := b.definitionsRegistry[id]
+		return ok && ((def.idType == idTypeClass) || (def.idType == idTypeFunction))
+	}
+
+	next := func(id string) []string {
+		if isObject(id) {
+			return nil
+		}
+
+		return b.assignmentGraph[id]
+	}
+
+	seed := func(id string) []string {
+		if isObject(id) {
+			return []string{id}
+		}
+
+		return nil
+	}
+
+	// Cycles such as a = b; b = a form a component sharing one set
+	nodes := append(sortedKeys(b.definitionsRegistry), sortedKeys(b.assignmentGraph)...)
+	return transitiveClosure(nodes, next, seed)
+}
+
+// Resolve receiver calls using points-to sets. New callees add return
+// value edges, which may grow the points-to sets, so this repeats
+// until no new callee is found
+func (b *AssignmentGraphBuilder) resolveReceiverCalls() {
+	if b.contextDepth > 0 {
+		b.cloneContexts()
+	}
+
+	pointsTo := b.computePointsTo()
+
+	// Past a limit the callees found so far are kept
+	for changed := true; changed && !b.limitReached(nil); {
+		changed = false
+
+		for _, call := range b.receiverCalls {
+			for _, object := range sortedKeys(b.receiverObjects(pointsTo, call.receiver)) {
+				callee, ok := b.resolveMember(b.definitionsRegistry[object], call.attributes)
+				if !ok || call.callees[callee.id()] {
+					continue
+				}
+
+				tracef("Resolved %s -> %s\n", call.name, callee.id())
+
+				call.callees[callee.id()] = true
+				changed = true
+
+				b.callEdgeFrom(call.caller, callee.id(), call.line)
+				b.bindReceiverCall(call, callee)
+			}
+		}
+
+		if changed {
+			// New callees add call sites to clone
+			if b.contextDepth > 0 {
+				b.cloneContexts()
+			}
+
+			pointsTo = b.computePointsTo()
+		}
+	}
+
+	for _, call := range b.receiverCalls {
+		if len(call.callees) == 0 {
+			b.callEdgeFrom(call.caller, call.name, call.line)
+		}
+	}
+
+	b.pointsTo = b.variablePointsTo(pointsTo)
+}
+
+// Objects a receiver may refer to. With contexts, a receiver inside a
+// function refers to the objects of any of its clones
+func (b *AssignmentGraphBuilder) receiverObjects(pointsTo map[string]map[string]bool,
+	receiver string) map[string]bool {
+	objects := make(map[string]bool)
+	for _, id := range append([]string{receiver}, b.contextClones[receiver]...) {
+		for object := range pointsTo[id] {
+			objects[object] = true
+		}
+	}
+
+	return objects
+}
+
+// Points-to sets of variables, sorted for output
+func (b *AssignmentGraphBuilder) variablePointsTo(pointsTo map[string]map[string]bool) map[string][]string {
+	variables := make(map[string][]string)
+	for _, id := range sortedKeys(pointsTo) {
+		if def := b.definitionsRegistry[id]; (def != nil) && (def.idType == idTypeVariable) {
+			variables[id] = sortedKeys(pointsTo[id])
+		}
+	}
+
+	return variables
+}
+
+// Connect arguments and return value of a receiver call to a resolved callee
+func (b *AssignmentGraphBuilder) bindReceiverCall(call *receiverCall, callee *definition) {
+	ret := b.definitionsRegistry[call.ret]
+
+	if callee.idType == idTypeClass {
+		b.assignmentEdge(ret, callee)
+		return
+	}
+
+	for _, arg := range call.args {
+		b.assignmentEdge(callee, b.definitionsRegistry[arg.def])
+	}
+
+	// Methods receive the receiver object as self
+	site := &callSite{
+		id:     call.site,
+		caller: call.caller,
+		callee: callee.id(),
+		args:   call.args,
+		ret:    call.ret,
+	}
+
+	if len(call.attributes) > 0 {
+		site.offset = 1
+	}
+
+	b.recordCallSite(site)
+
+	// Return values are shared while resolving, even with contexts, so
+	// that calls on returned objects resolve. Cloning replaces them
+	if calleeRet, ok := b.returnDefinition(callee.id()); ok {
+		b.assignmentEdge(ret, calleeRet)
+	}
+}
+
+// Resolve attributes on an object. Class members are searched in the
+// class and then in its superclasses, depth first in declaration order
+func (b *AssignmentGraphBuilder) resolveMember(object *definition, attributes []string) (*definition, bool) {
+	def := object
+	for _, attr := range attributes {
+		if def.idType != idTypeClass {
+			return nil, false
+		}
+
+		member, ok := b.lookupClassMember(def, attr)
+		if !ok {
+			return nil, false
+		}
+
+		def = member
+	}
+
+	if (def.idType != idTypeFunction) && (def.idType != idTypeClass) {
+		return nil, false
+	}
+
+	return def, true
+}
+
+func (b *AssignmentGraphBuilder) lookupClassMember(class *definition, name string) (*definition, bool) {
+	var member *definition
+
+	depthFirst([]string{class.id()}, func(id string) []string {
+		return b.classHierarchy[id]
+	}, func(id string) bool {
+		if member != nil {
+			return false
+		}
+
+		if def, ok := b.definitionsRegistry[id]; ok && (def.scope != nil) {
+			member, _ = def.scope.lookup(name)
+		}
+
+		return member == nil
+	})
+
+	return member, member != nil
+}
@@ -0,0 +1,786 @@
+package main
+
+// A small Datalog dialect for ad-hoc questions over the analysis results.
+// Facts are derived from the builder:
+//
+//	def(Id, Type, Name)       definitions registry
+//	defined_in(Id, Namespace) definition of the namespace an id was created in
+//	inherits(Class, Super)    class hierarchy
+//	assigns(Target, Value)    assignment graph
+//	calls(Caller, Callee)     call graph, unresolved callees by dotted name
+//	points_to(Var, Object)    classes and functions a variable may refer to
+//
+// Rules derive new relations and a query prints the bindings of its
+// variables. Variables start with an upper case letter or _, constants
+// are quoted strings or lower case atoms:
+//
+//	derives(C, P) :- inherits(C, P).
+//	derives(C, P) :- inherits(C, X), derives(X, P).
+//	?- derives(C, P), def(P, class, "setuptools.Command").
+//
+// Builtins, which require their arguments to be bound:
+//
+//	re(X, "regexp")  X matches the regular expression
+//	eq(X, Y)         X and Y are equal
+//	neq(X, Y)        X and Y are not equal
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type queryTerm struct {
+	variable bool
+	value    string
+}
+
+type queryAtom struct {
+	predicate string
+	args      []queryTerm
+}
+
+type queryRule struct {
+	head queryAtom
+	body []queryAtom
+}
+
+// Statements of a query program, a query is a conjunction of atoms
+type queryProgram struct {
+	rules   []queryRule
+	queries [][]queryAtom
+}
+
+type queryToken struct {
+	kind  string
+	value string
+	pos   int
+}
+
+const (
+	queryTokenAtom     = "atom"
+	queryTokenVariable = "variable"
+	queryTokenString   = "string"
+	queryTokenPunct    = "punct"
+	queryTokenEOF      = "eof"
+)
+
+func tokenizeQuery(text string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+
+	for pos := 0; pos < len(text); {
+		c := rune(text[pos])
+
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case c == '%':
+			// Comment until the end of line
+			for (pos < len(text)) && (text[pos] != '\n') {
+				pos++
+			}
+		case strings.HasPrefix(text[pos:], ":-"), strings.HasPrefix(text[pos:], "?-"):
+			tokens = append(tokens, queryToken{queryTokenPunct, text[pos : pos+2], pos})
+			pos += 2
+		case strings.ContainsRune("(),.", c):
+			tokens = append(tokens, queryToken{queryTokenPunct, string(c), pos})
+			pos++
+		case c == '"':
+			end := pos + 1
+			for (end < len(text)) && (text[end] != '"') {
+				if text[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(text) {
+				return nil, fmt.Errorf("unterminated string at %d", pos)
+			}
+
+			value, err := strconv.Unquote(text[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", pos, err)
+			}
+
+			tokens = append(tokens, queryToken{queryTokenString, value, pos})
+			pos = end + 1
+		case (c == '_') || unicode.IsLetter(c) || unicode.IsDigit(c):
+			end := pos
+			for (end < len(text)) && ((text[end] == '_') ||
+				unicode.IsLetter(rune(text[end])) || unicode.IsDigit(rune(text[end]))) {
+				end++
+			}
+
+			kind := queryTokenAtom
+			if (c == '_') || unicode.IsUpper(c) {
+				kind = queryTokenVariable
+			}
+
+			tokens = append(tokens, queryToken{kind, text[pos:end], pos})
+			pos = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, pos)
+		}
+	}
+
+	return append(tokens, queryToken{queryTokenEOF, "", len(text)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.pos]
+	if token.kind != queryTokenEOF {
+		p.pos++
+	}
+
+	return token
+}
+
+func (p *queryParser) accept(punct string) bool {
+	if token := p.peek(); (token.kind == queryTokenPunct) && (token.value == punct) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *queryParser) expect(punct string) error {
+	if !p.accept(punct) {
+		token := p.peek()
+		return fmt.Errorf("expected %q at %d, found %q", punct, token.pos, token.value)
+	}
+
+	return nil
+}
+
+// Parse a query program. Text without rules or an explicit ?- is
+// parsed as a single query
+func parseQueryProgram(text string) (*queryProgram, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &queryParser{tokens: tokens}
+	program := &queryProgram{}
+
+	shorthand := true
+	for _, token := range tokens {
+		if (token.kind == queryTokenPunct) && ((token.value == "?-") || (token.value == ":-")) {
+			shorthand = false
+		}
+	}
+
+	if shorthand {
+		body, err := parser.parseBody()
+		if err != nil {
+			return nil, err
+		}
+
+		parser.accept(".")
+		if parser.peek().kind != queryTokenEOF {
+			return nil, fmt.Errorf("unexpected %q at %d", parser.peek().value, parser.peek().pos)
+		}
+
+		program.queries = append(program.queries, body)
+		return program, nil
+	}
+
+	for parser.peek().kind != queryTokenEOF {
+		if parser.accept("?-") {
+			body, err := parser.parseBody()
+			if err != nil {
+				return nil, err
+			}
+
+			// The final statement may omit the period
+			if !parser.accept(".") && (parser.peek().kind != queryTokenEOF) {
+				return nil, parser.expect(".")
+			}
+
+			program.queries = append(program.queries, body)
+			continue
+		}
+
+		rule, err := parser.parseRule()
+		if err != nil {
+			return nil, err
+		}
+
+		program.rules = append(program.rules, rule)
+	}
+
+	return program, nil
+}
+
+func (p *queryParser) parseRule() (queryRule, error) {
+	head, err := p.parseAtom()
+	if err != nil {
+		return queryRule{}, err
+	}
+
+	rule := queryRule{head: head}
+	if p.accept(":-") {
+		if rule.body, err = p.parseBody(); err != nil {
+			return queryRule{}, err
+		}
+	}
+
+	if err := p.expect("."); err != nil {
+		return queryRule{}, err
+	}
+
+	// Rules must be range restricted for the fixpoint to be finite
+	bound := make(map[string]bool)
+	for _, atom := range rule.body {
+		for _, arg := range atom.args {
+			if arg.variable {
+				bound[arg.value] = true
+			}
+		}
+	}
+
+	for _, arg := range head.args {
+		if arg.variable && ((arg.value == "_") || !bound[arg.value]) {
+			return queryRule{}, fmt.Errorf("variable %s in head of %s is not bound by its body",
+				arg.value, head.predicate)
+		}
+	}
+
+	return rule, nil
+}
+
+func (p *queryParser) parseBody() ([]queryAtom, error) {
+	body := make([]queryAtom, 0)
+	for {
+		atom, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+
+		body = append(body, atom)
+		if !p.accept(",") {
+			return body, nil
+		}
+	}
+}
+
+func (p *queryParser) parseAtom() (queryAtom, error) {
+	token := p.next()
+	if token.kind != queryTokenAtom {
+		return queryAtom{}, fmt.Errorf("expected predicate at %d, found %q", token.pos, token.value)
+	}
+
+	atom := queryAtom{predicate: token.value}
+	if err := p.expect("("); err != nil {
+		return queryAtom{}, err
+	}
+
+	for {
+		token := p.next()
+		switch token.kind {
+		case queryTokenVariable:
+			atom.args = append(atom.args, queryTerm{variable: true, value: token.value})
+		case queryTokenAtom, queryTokenString:
+			atom.args = append(atom.args, queryTerm{value: token.value})
+		default:
+			return queryAtom{}, fmt.Errorf("expected term at %d, found %q", token.pos, token.value)
+		}
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect(")"); err != nil {
+		return queryAtom{}, err
+	}
+
+	return atom, nil
+}
+
+// Set of tuples per predicate
+type factDatabase struct {
+	relations map[string][][]string
+	seen      map[string]bool
+	patterns  map[string]*regexp.Regexp
+}
+
+func newFactDatabase() *factDatabase {
+	return &factDatabase{
+		relations: make(map[string][][]string),
+		seen:      make(map[string]bool),
+		patterns:  make(map[string]*regexp.Regexp),
+	}
+}
+
+func (db *factDatabase) add(predicate string, tuple ...string) bool {
+	key := predicate + "\x00" + strings.Join(tuple, "\x00")
+	if db.seen[key] {
+		return false
+	}
+
+	db.seen[key] = true
+	db.relations[predicate] = append(db.relations[predicate], tuple)
+
+	return true
+}
+
+// Facts about the analysis results held by the builder
+func (b *AssignmentGraphBuilder) factDatabase() *factDatabase {
+	db := newFactDatabase()
+
+	for id, def := range b.definitionsRegistry {
+		db.add("def", id, string(def.idType), def.name)
+		if (def.ns != nil) && (def.ns.definition != nil) {
+			db.add("defined_in", id, def.ns.definition.id())
+		}
+	}
+
+	for class, supers := range b.classHierarchy {
+		for _, super := range supers {
+			db.add("inherits", class, super)
+		}
+	}
+
+	for target, values := range b.assignmentGraph {
+		for _, value := range values {
+			db.add("assigns", target, value)
+		}
+	}
+
+	for caller, callees := range b.callGraph {
+		for _, callee := range callees {
+			db.add("calls", caller, callee)
+		}
+	}
+
+	for variable, objects := range b.pointsTo {
+		for _, object := range objects {
+			db.add("points_to", variable, object)
+		}
+	}
+
+	return db
+}
+
+var queryBuiltins = map[string]func(db *factDatabase, args []string) (bool, error){
+	"re": func(db *factDatabase, args []string) (bool, error) {
+		pattern, ok := db.patterns[args[1]]
+		if !ok {
+			var err error
+			if pattern, err = regexp.Compile(args[1]); err != nil {
+				return false, err
+			}
+
+			db.patterns[args[1]] = pattern
+		}
+
+		return pattern.MatchString(args[0]), nil
+	},
+	"eq": func(_ *factDatabase, args []string) (bool, error) {
+		return args[0] == args[1], nil
+	},
+	"neq": func(_ *factDatabase, args []string) (bool, error) {
+		return args[0] != args[1], nil
+	},
+}
+
+// Find all bindings satisfying the conjunction of atoms
+func (db *factDatabase) solve(body []queryAtom, binding map[string]string,
+	emit func(map[string]string)) error {
+	if len(body) == 0 {
+		emit(binding)
+		return nil
+	}
+
+	atom := body[0]
+
+	if builtin, ok := queryBuiltins[atom.predicate]; ok {
+		if len(atom.args) != 2 {
+			return fmt.Errorf("%s: expected 2 arguments", atom.predicate)
+		}
+
+		args := make([]string, 0, len(atom.args))
+		for _, arg := range atom.args {
+			value, bound := arg.value, !arg.variable
+			if arg.variable {
+				value, bound = binding[arg.value]
+			}
+
+			if !bound {
+				return fmt.Errorf("%s: variable %s is not bound", atom.predicate, arg.value)
+			}
+
+			args = append(args, value)
+		}
+
+		matched, err := builtin(db, args)
+		if err != nil {
+			return fmt.Errorf("%s: %w", atom.predicate, err)
+		}
+
+		if matched {
+			return db.solve(body[1:], binding, emit)
+		}
+
+		return nil
+	}
+
+	for _, tuple := range db.relations[atom.predicate] {
+		extended, ok := unifyTuple(atom.args, tuple, binding)
+		if !ok {
+			continue
+		}
+
+		if err := db.solve(body[1:], extended, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unifyTuple(args []queryTerm, tuple []string, binding map[string]string) (map[string]string, bool) {
+	if len(args) != len(tuple) {
+		return nil, false
+	}
+
+	extended := binding
+	copied := false
+
+	for i, arg := range args {
+		if !arg.variable {
+			if arg.value != tuple[i] {
+				return nil, false
+			}
+
+			continue
+		}
+
+		if arg.value == "_" {
+			continue
+		}
+
+		if value, ok := extended[arg.value]; ok {
+			if value != tuple[i] {
+				return nil, false
+			}
+
+			continue
+		}
+
+		// Copy on first write, the binding is shared by siblings
+		if !copied {
+			extended = make(map[string]string, len(binding)+1)
+			for k, v := range binding {
+				extended[k] = v
+			}
+
+			copied = true
+		}
+
+		extended[arg.value] = tuple[i]
+	}
+
+	return extended, true
+}
+
+// Derive facts from rules until a fixpoint is reached
+func (db *factDatabase) derive(rules []queryRule) error {
+	heads := make(map[string]bool)
+	for _, rule := range rules {
+		heads[rule.head.predicate] = true
+	}
+
+	for _, rule := range rules {
+		if err := db.checkPredicates(rule.body, heads); err != nil {
+			return err
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, rule := range rules {
+			derived := make([][]string, 0)
+			err := db.solve(rule.body, map[string]string{}, func(binding map[string]string) {
+				tuple := make([]string, 0, len(rule.head.args))
+				for _, arg := range rule.head.args {
+					if arg.variable {
+						tuple = append(tuple, binding[arg.value])
+					} else {
+						tuple = append(tuple, arg.value)
+					}
+				}
+
+				derived = append(derived, tuple)
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, tuple := range derived {
+				if db.add(rule.head.predicate, tuple...) {
+					changed = true
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Catch typos in predicate names, which would silently match nothing
+func (db *factDatabase) checkPredicates(body []queryAtom, heads map[string]bool) error {
+	known := map[string]bool{"def": true, "defined_in": true, "inherits": true,
+		"assigns": true, "calls": true, "points_to": true}
+
+	for _, atom := range body {
+		if _, ok := queryBuiltins[atom.predicate]; ok {
+			continue
+		}
+
+		if !known[atom.predicate] && !heads[atom.predicate] {
+			return fmt.Errorf("unknown predicate: %s", atom.predicate)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate a query, returning the distinct bindings of its named
+// variables sorted for stable output
+func (db *factDatabase) query(rules []queryRule, query []queryAtom) ([]map[string]string, error) {
+	if err := db.derive(rules); err != nil {
+		return nil, err
+	}
+
+	heads := make(map[string]bool)
+	for _, rule := range rules {
+		heads[rule.head.predicate] = true
+	}
+
+	if err := db.checkPredicates(query, heads); err != nil {
+		return nil, err
+	}
+
+	variables := queryVariables(query)
+	results := make([]map[string]string, 0)
+	seen := make(map[string]bool)
+
+	err := db.solve(query, map[string]string{}, func(binding map[string]string) {
+		result := make(map[string]string, len(variables))
+		values := make([]string, 0, len(variables))
+
+		for _, variable := range variables {
+			result[variable] = binding[variable]
+			values = append(values, binding[variable])
+		}
+
+		key := strings.Join(values, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			results = append(results, result)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		for _, variable := range variables {
+			if results[i][variable] != results[j][variable] {
+				return results[i][variable] < results[j][variable]
+			}
+		}
+
+		return false
+	})
+
+	return results, nil
+}
+
+// Named variables of a query in order of appearance
+func queryVariables(query []queryAtom) []string {
+	variables := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, atom := range query {
+		for _, arg := range atom.args {
+			if arg.variable && !strings.HasPrefix(arg.value, "_") && !seen[arg.value] {
+				seen[arg.value] = true
+				variables = append(variables, arg.value)
+			}
+		}
+	}
+
+	return variables
+}
+
+// Run a query program against the builder. Rules persist across queries
+// in the same program
+func (b *AssignmentGraphBuilder) runQuery(program *queryProgram) ([][]map[string]string, error) {
+	results := make([][]map[string]string, 0, len(program.queries))
+	for _, query := range program.queries {
+		result, err := b.factDatabase().query(program.rules, query)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func queryCommand(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	expression := flags.String("e", "", "Query to evaluate, reads queries interactively when empty")
+
+	var options analysisOptions
+	flags.IntVar(&options.contextDepth, "k", 0, "Call site sensitivity, clones functions per call context when > 0")
+	options.limits.registerFlags(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s query [-e <query>] [-k <depth>] <file.py>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file to analyze")
+	}
+
+	traceOutput = io.Discard
+
+	builder, diagnostics, err := analyzeFile(fileToModuleName(flags.Arg(0)), flags.Arg(0), options)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range diagnostics {
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", d.File, d.Line, d.Column, d.Message)
+	}
+
+	if *expression == "" {
+		return builder.queryShell(os.Stdin, os.Stdout)
+	}
+
+	program, err := parseQueryProgram(*expression)
+	if err != nil {
+		return err
+	}
+
+	if len(program.queries) != 1 {
+		return fmt.Errorf("expected a single query, found %d", len(program.queries))
+	}
+
+	results, err := builder.runQuery(program)
+	if err != nil {
+		return err
+	}
+
+	jsonResults, err := json.MarshalIndent(results[0], "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(jsonResults))
+	return nil
+}
+
+// Read statements terminated by a period and evaluate them. Rules are
+// kept for the rest of the session
+func (b *AssignmentGraphBuilder) queryShell(in io.Reader, out io.Writer) error {
+	rules := make([]queryRule, 0)
+	scanner := bufio.NewScanner(in)
+
+	var statement strings.Builder
+	fmt.Fprint(out, "?- ")
+
+	for scanner.Scan() {
+		statement.WriteString(scanner.Text())
+		statement.WriteString("\n")
+
+		text := strings.TrimSpace(statement.String())
+		if (text != "") && !strings.HasSuffix(text, ".") {
+			fmt.Fprint(out, "|  ")
+			continue
+		}
+
+		statement.Reset()
+
+		if text != "" {
+			if err := b.evalShellStatement(text, &rules, out); err != nil {
+				fmt.Fprintf(out, "Error: %s\n", err)
+			}
+		}
+
+		fmt.Fprint(out, "?- ")
+	}
+
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
+
+func (b *AssignmentGraphBuilder) evalShellStatement(text string, rules *[]queryRule, out io.Writer) error {
+	program, err := parseQueryProgram(text)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range program.queries {
+		result, err := b.factDatabase().query(append(*rules, program.rules...), query)
+		if err != nil {
+			return err
+		}
+
+		variables := queryVariables(query)
+		for _, row := range result {
+			values := make([]string, 0, len(variables))
+			for _, variable := range variables {
+				values = append(values, fmt.Sprintf("%s = %s", variable, strconv.Quote(row[variable])))
+			}
+
+			fmt.Fprintln(out, strings.Join(values, ", "))
+		}
+
+		fmt.Fprintf(out, "%d result(s)\n", len(result))
+	}
+
+	// Validate rules before keeping them for the session
+	if len(program.rules) > 0 {
+		if err := b.factDatabase().derive(append(*rules, program.rules...)); err != nil {
+			return err
+		}
+
+		*rules = append(*rules, program.rules...)
+		fmt.Fprintf(out, "%d rule(s) added\n", len(program.rules))
+	}
+
+	return nil
+}
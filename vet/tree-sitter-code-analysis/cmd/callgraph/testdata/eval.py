@@ -0,0 +1,3 @@
+import os
+
+value = eval("1+")
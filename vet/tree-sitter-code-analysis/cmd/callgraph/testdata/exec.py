@@ -0,0 +1,5 @@
+s = "exec(s)"
+exec(s)
+
+code = "import os\nos.system('id')"
+exec(code)
@@ -0,0 +1,5 @@
+from urllib import request as r
+
+
+def fetch(url):
+    return r.urlopen(url).read()
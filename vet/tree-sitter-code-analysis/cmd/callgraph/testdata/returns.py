@@ -0,0 +1,26 @@
+class A:
+    pass
+
+class B:
+    pass
+
+def outer():
+    def inner():
+        pass
+    x = inner()
+    if x:
+        return A
+    return B
+
+def sub():
+    yield B
+    return A
+
+def gen():
+    yield A
+    yield from sub()
+
+for item in gen():
+    y = item
+
+z = outer()
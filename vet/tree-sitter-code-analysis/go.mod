@@ -2,4 +2,8 @@ module github.com/safedep/examples/vet/tree-sitter-code-analysis
 
 go 1.22.1
 
-require github.com/smacker/go-tree-sitter v0.0.0-20240625050157-a31a98a7c0f6 // indirect
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/smacker/go-tree-sitter v0.0.0-20240625050157-a31a98a7c0f6
+)